@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// requireAPIKey only lets through requests whose X-API-Key header matches key.
+func requireAPIKey(key string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given := r.Header.Get("X-API-Key")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+				respondError(w, r, http.StatusUnauthorized, "invalid or missing API key")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maintenanceMu serializes maintenance runs, since VACUUM locks the whole
+// database while it rebuilds the file.
+var maintenanceMu sync.Mutex
+
+type maintenanceResult struct {
+	VacuumMS   float64 `json:"vacuum_ms"`
+	AnalyzeMS  float64 `json:"analyze_ms"`
+	SizeBefore int64   `json:"size_before"`
+	SizeAfter  int64   `json:"size_after"`
+}
+
+func (h *handler) runMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !maintenanceMu.TryLock() {
+		respondError(w, r, http.StatusConflict, "maintenance already in progress")
+		return
+	}
+	defer maintenanceMu.Unlock()
+
+	var result maintenanceResult
+	var err error
+	ds := h.store(r)
+
+	result.SizeBefore, err = ds.SizeBytes()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("maintenance: database size before %d bytes", result.SizeBefore)
+
+	start := time.Now()
+	if err := ds.Vacuum(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result.VacuumMS = milliseconds(time.Since(start))
+
+	start = time.Now()
+	if err := ds.Analyze(); err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result.AnalyzeMS = milliseconds(time.Since(start))
+
+	result.SizeAfter, err = ds.SizeBytes()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("maintenance: database size after %d bytes", result.SizeAfter)
+
+	respondJSON(w, r, http.StatusOK, result)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// backupDatabase streams a snapshot of the database as a file download. The
+// snapshot is taken with VACUUM INTO so it is consistent even while the
+// database is being written to, and is removed once it has been sent.
+func (h *handler) backupDatabase(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "chiao-backup-")
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := h.store(r).BackupTo(path); err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("students-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("backup: streaming snapshot: %v", err)
+	}
+}
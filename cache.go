@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// ttlCache memoizes the results of aggregate queries for ttl. Any write
+// request and every chunk an import commits clears it, so a dashboard sees
+// changes immediately and polls in between are answered without touching
+// the database. A zero ttl disables caching.
+type ttlCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation counts invalidations. A load that was running while the
+	// cache was invalidated may have read the old state, so its result is
+	// returned but not stored.
+	generation uint64
+	hits       uint64
+	misses     uint64
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+// cached returns the value stored under key, calling load and storing its
+// result when there is none or it has expired. Errors are not cached.
+func cached[T any](c *ttlCache, key string, load func() (T, error)) (T, error) {
+	if c.ttl <= 0 {
+		return load()
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expires) {
+		c.hits++
+		c.mu.Unlock()
+		return e.value.(T), nil
+	}
+	c.misses++
+	generation := c.generation
+	c.mu.Unlock()
+
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.entries[key] = cacheEntry{value: v, expires: time.Now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return v, nil
+}
+
+func (c *ttlCache) invalidate() {
+	c.mu.Lock()
+	c.entries = map[string]cacheEntry{}
+	c.generation++
+	c.mu.Unlock()
+}
+
+// invalidateOnWrite clears the cache once any request that may have written
+// has completed. It runs outside txMiddleware, so the transaction has been
+// committed by then and the next read cannot cache the old state.
+func (c *ttlCache) invalidateOnWrite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			c.invalidate()
+		}
+	})
+}
+
+func (c *ttlCache) writeMetrics(w io.Writer) {
+	c.mu.Lock()
+	hits, misses := c.hits, c.misses
+	c.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP cache_hits_total Aggregate queries answered from the cache.")
+	fmt.Fprintln(w, "# TYPE cache_hits_total counter")
+	fmt.Fprintf(w, "cache_hits_total %d\n", hits)
+	fmt.Fprintln(w, "# HELP cache_misses_total Aggregate queries that had to run against the database.")
+	fmt.Fprintln(w, "# TYPE cache_misses_total counter")
+	fmt.Fprintf(w, "cache_misses_total %d\n", misses)
+}
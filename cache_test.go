@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedDropsRacedLoad(t *testing.T) {
+	c := newTTLCache(time.Minute)
+
+	// The cache is cleared while the first load runs, so what it read may
+	// be stale: it is returned but not kept.
+	v, _ := cached(c, "k", func() (int, error) {
+		c.invalidate()
+		return 1, nil
+	})
+	if v != 1 {
+		t.Fatalf("first load returned %d, want 1", v)
+	}
+	if v, _ := cached(c, "k", func() (int, error) { return 2, nil }); v != 2 {
+		t.Errorf("got %d after a raced load, want a fresh 2", v)
+	}
+	if v, _ := cached(c, "k", func() (int, error) { return 3, nil }); v != 2 {
+		t.Errorf("got %d, want the cached 2", v)
+	}
+}
+
+func TestImportJobClearsCache(t *testing.T) {
+	ds := newTestDatastore(t)
+	c := newTTLCache(time.Minute)
+	if n, _ := cached(c, "stats", ds.Stats); n.Count != 0 {
+		t.Fatalf("stats count %d students, want 0", n.Count)
+	}
+
+	// A background import outlives its request, so clearing the cache at
+	// the end of the request is not enough; its chunks clear it as they
+	// commit.
+	job := importJob{ID: "job", Status: jobPending, Total: 3}
+	runImportJob(context.Background(), ds, job, []byte(importCSVBody(3)), 2, nil, Student.Validate, c)
+	if n, _ := cached(c, "stats", ds.Stats); n.Count != 3 {
+		t.Errorf("stats count %d students after the import, want 3", n.Count)
+	}
+}
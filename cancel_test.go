@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// cancelingFlusher is a response writer whose client goes away at the first
+// flush.
+type cancelingFlusher struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w cancelingFlusher) Flush() {
+	w.ResponseRecorder.Flush()
+	w.cancel()
+}
+
+func TestExportStopsWhenClientGoesAway(t *testing.T) {
+	h, ds := newTestRouter(t)
+	seedStudents(t, ds, 3*exportFlushRows)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/students.csv", nil).WithContext(ctx)
+	w := cancelingFlusher{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	h.ServeHTTP(w, req)
+
+	// The client left once the first rows were flushed; nothing after them
+	// was scanned or written.
+	if got := exportNIMs(t, w.Body.String()); len(got) != exportFlushRows {
+		t.Errorf("exported %d rows, want the %d flushed before the client went away", len(got), exportFlushRows)
+	}
+}
+
+// cancelingReader cancels the request after its first Read, as a client
+// going away while still uploading.
+type cancelingReader struct {
+	r      *strings.Reader
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads > 1 {
+		r.cancel()
+	}
+	return r.r.Read(p)
+}
+
+func TestImportStopsWhenClientGoesAway(t *testing.T) {
+	const rows = 2000
+	h, ds := newTestRouter(t)
+
+	var body strings.Builder
+	body.WriteString("nim,name,age,address\n")
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&body, "%06d,Ana,20,Bandung\n", i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &cancelingReader{r: strings.NewReader(body.String()), cancel: cancel}
+	req := httptest.NewRequest(http.MethodPost, "/students/import?chunk_size=100", r).WithContext(ctx)
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("answered a client that went away: %s", rec.Body)
+	}
+	// Whatever was committed before the cancellation stays, in whole chunks,
+	// but the import did not run to the end.
+	stored := countStudents(t, ds)
+	if stored >= rows || stored%100 != 0 {
+		t.Errorf("%d of %d rows stored, want fewer, in whole chunks of 100", stored, rows)
+	}
+}
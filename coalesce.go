@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errFlightPanicked is returned to the callers that were waiting for a call
+// that panicked.
+var errFlightPanicked = errors.New("coalesced call panicked")
+
+// flightGroup coalesces concurrent calls with the same key: while one call
+// is running, later callers wait for it and share its result instead of
+// running their own. It is a minimal stand-in for x/sync/singleflight.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flight[T]
+}
+
+type flight[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+func newFlightGroup[T any]() *flightGroup[T] {
+	return &flightGroup[T]{calls: map[string]*flight[T]{}}
+}
+
+// do runs fn unless a call for key is already running, in which case it
+// waits for that call. shared reports whether the result came from another
+// caller's fn.
+func (g *flightGroup[T]) do(key string, fn func() (T, error)) (value T, err error, shared bool) {
+	g.mu.Lock()
+	if f, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-f.done
+		return f.value, f.err, true
+	}
+	f := &flight[T]{done: make(chan struct{})}
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	// A panicking fn fails the waiters with errFlightPanicked before the
+	// panic carries on up the caller's stack.
+	defer func() {
+		rvr := recover()
+		if rvr != nil {
+			f.err = fmt.Errorf("%w: %v", errFlightPanicked, rvr)
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(f.done)
+
+		if rvr != nil {
+			panic(rvr)
+		}
+	}()
+
+	f.value, f.err = fn()
+	return f.value, f.err, false
+}
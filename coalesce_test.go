@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestFlightGroupCoalesces checks that concurrent lookups of one key run the
+// query once and all get its result.
+func TestFlightGroupCoalesces(t *testing.T) {
+	const callers = 50
+
+	g := newFlightGroup[Student]()
+	var queries int32
+	release := make(chan struct{})
+	query := func() (Student, error) {
+		atomic.AddInt32(&queries, 1)
+		<-release
+		return Student{NIM: "2021000001", Name: "Ana"}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]Student, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i], _ = g.do("school-a\x002021000001", query)
+		}(i)
+	}
+
+	// Give every caller time to join the first one's call.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Errorf("%d callers ran %d queries, want 1", callers, n)
+	}
+	for i := range results {
+		if errs[i] != nil || results[i].Name != "Ana" {
+			t.Errorf("caller %d got %+v, %v", i, results[i], errs[i])
+		}
+	}
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	g := newFlightGroup[Student]()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		g.do("key", func() (Student, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+
+	<-started
+	waiter := make(chan error, 1)
+	go func() {
+		_, err, _ := g.do("key", func() (Student, error) {
+			t.Error("waiter ran its own call")
+			return Student{}, nil
+		})
+		waiter <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if rvr := <-panicked; rvr != "boom" {
+		t.Errorf("caller recovered %v, want the panic to reach it", rvr)
+	}
+	if err := <-waiter; !errors.Is(err, errFlightPanicked) {
+		t.Errorf("waiter got %v, want errFlightPanicked", err)
+	}
+}
+
+// TestFindByNIMJoinsLookup checks that FindByNIM waits for a lookup of the
+// same student already in flight instead of querying the database itself.
+func TestFindByNIMJoinsLookup(t *testing.T) {
+	ds := newTestDatastore(t)
+	addStudents(t, ds, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+
+	// Stand in for a query already running: its result is not what the
+	// database holds, so a caller that queried would notice.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go ds.lookups.do("\x001301", func() (Student, error) {
+		close(started)
+		<-release
+		return Student{NIM: "1301", Name: "In flight"}, nil
+	})
+	<-started
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]Student, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = ds.FindByNIM("1301")
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] != nil || results[i].Name != "In flight" {
+			t.Errorf("caller %d got %+v, %v, want the in-flight result", i, results[i], errs[i])
+		}
+	}
+
+	// Once the call is done, the next lookup queries again.
+	student, err := ds.FindByNIM("1301")
+	if err != nil || student.Name != "Ana" {
+		t.Errorf("later lookup got %+v, %v, want the stored student", student, err)
+	}
+
+	// A lookup in another school is a different key.
+	if _, err := ds.ForSchool("school-b").FindByNIM("1301"); !errors.Is(err, errDataNotFound) {
+		t.Errorf("other school got %v, want errDataNotFound", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressResponse gzips responses for clients that accept it once they grow
+// past threshold bytes. Smaller responses, which are most single-student
+// ones, are sent as they are because compressing them costs more CPU than it
+// saves bandwidth. A negative threshold disables compression.
+func compressResponse(threshold int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if threshold < 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, threshold: threshold}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, either
+// by name or through *, with a non-zero q.
+func acceptsGzip(header string) bool {
+	q := -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		cq := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				cq = f
+			}
+		}
+		// An explicit gzip entry overrides the wildcard.
+		if coding == "gzip" || q < 0 {
+			q = cq
+		}
+		if coding == "gzip" {
+			break
+		}
+	}
+	return q > 0
+}
+
+// compressWriter holds back the status and body until either threshold bytes
+// have been written, at which point it switches to gzip, or the handler is
+// done or flushes, at which point the buffered body goes out uncompressed.
+type compressWriter struct {
+	http.ResponseWriter
+	threshold int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.decided {
+		if cw.gz != nil {
+			return cw.gz.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf.Write(p)
+	if cw.buf.Len() > cw.threshold {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide sends the header, compressed when compress is set and the handler
+// did not encode the body itself, followed by the buffered body.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if compress && h.Get("Content-Encoding") == "" && bodyAllowed(cw.status) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		cw.gz = gzip.NewWriter(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.gz != nil {
+		_, err = cw.gz.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// Flush sends what has been written so far; a response still under the
+// threshold is then sent uncompressed, so streaming is not held up.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(false)
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends a response that stayed under the threshold, or finishes the
+// gzip stream of one that did not.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		// Nothing was written when the status is still unset; leave the
+		// implicit 200 to net/http.
+		if cw.status == 0 && cw.buf.Len() == 0 {
+			return nil
+		}
+		return cw.decide(false)
+	}
+	if cw.gz != nil {
+		return cw.gz.Close()
+	}
+	return nil
+}
+
+// bodyAllowed reports whether a response with status may have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
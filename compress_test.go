@@ -0,0 +1,89 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestCompressThreshold(t *testing.T) {
+	tests := []struct {
+		name       string
+		threshold  int
+		target     string
+		accept     string
+		compressed bool
+	}{
+		{"small response", 1024, "/students/000001", "gzip", false},
+		{"large list", 1024, "/students?limit=100", "gzip", true},
+		{"client without gzip", 1024, "/students?limit=100", "", false},
+		{"gzip refused", 1024, "/students?limit=100", "gzip;q=0, *", false},
+		{"wildcard", 1024, "/students?limit=100", "*", true},
+		{"disabled", -1, "/students?limit=100", "gzip", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CompressThreshold = tt.threshold
+			h, ds := newTestRouter(t, WithConfig(cfg))
+			seedStudents(t, ds, 100)
+
+			plain := serve(h, http.MethodGet, tt.target, "")
+			rec := serve(h, http.MethodGet, tt.target, "", "Accept-Encoding", tt.accept)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+
+			body := rec.Body.String()
+			if got := rec.Header().Get("Content-Encoding") == "gzip"; got != tt.compressed {
+				t.Fatalf("compressed %v, want %v", got, tt.compressed)
+			}
+			if tt.compressed {
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("gzip reader: %v", err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("inflate: %v", err)
+				}
+				body = string(b)
+			}
+			if got, want := responseData(t, body), responseData(t, plain.Body.String()); got != want {
+				t.Errorf("data differs from the uncompressed response:\n%.200s\n%.200s", got, want)
+			}
+		})
+	}
+}
+
+// responseData returns the data member of an enveloped JSON response, the
+// part that does not vary from one request to the next.
+func responseData(t *testing.T, body string) string {
+	t.Helper()
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("decode %.200s: %v", body, err)
+	}
+	return string(resp.Data)
+}
+
+func TestCompressAtThreshold(t *testing.T) {
+	for _, size := range []int{1023, 1024, 1025} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			h := compressResponse(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(make([]byte, size))
+			}))
+			rec := serve(h, http.MethodGet, "/", "", "Accept-Encoding", "gzip")
+			if got, want := rec.Header().Get("Content-Encoding") == "gzip", size > 1024; got != want {
+				t.Errorf("%d bytes compressed %v, want %v", size, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// computedFields are fields derived from the stored ones when a student is
+// serialized. They are never stored, and only sent when asked for with
+// ?include=. Adding one is a matter of adding an entry here.
+var computedFields = map[string]func(Student) any{
+	"display_name": func(s Student) any { return fmt.Sprintf("%s (%s)", s.Name, s.NIM) },
+}
+
+// parseInclude reads the comma separated ?include= list of computed fields.
+func parseInclude(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("include")
+	if v == "" {
+		return nil, nil
+	}
+
+	var include []string
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || containsString(include, name) {
+			continue
+		}
+		if _, ok := computedFields[name]; !ok {
+			return nil, fmt.Errorf("cannot include %q, expected one of %s", name, strings.Join(computedFieldNames(), ", "))
+		}
+		include = append(include, name)
+	}
+	return include, nil
+}
+
+func computedFieldNames() []string {
+	names := make([]string, 0, len(computedFields))
+	for name := range computedFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
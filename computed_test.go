@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestComputedFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		// wantKeys are the members of the (first) student.
+		wantKeys []string
+	}{
+		{"not included", "/students/1301", http.StatusOK, []string{"address", "age", "created_at", "name", "nim", "updated_at"}},
+		{"included", "/students/1301?include=display_name", http.StatusOK, []string{"address", "age", "created_at", "display_name", "name", "nim", "updated_at"}},
+		{"with fields", "/students/1301?fields=name&include=display_name", http.StatusOK, []string{"display_name", "name"}},
+		{"repeated", "/students/1301?fields=nim&include=display_name,display_name", http.StatusOK, []string{"display_name", "nim"}},
+		{"in a listing", "/students?fields=nim&include=display_name", http.StatusOK, []string{"display_name", "nim"}},
+		{"in a page", "/students?fields=nim&include=display_name&limit=10", http.StatusOK, []string{"display_name", "nim"}},
+		{"camelCase", "/students/1301?fields=nim&include=display_name&naming=camel", http.StatusOK, []string{"displayName", "nim"}},
+		{"unknown", "/students/1301?include=initials", http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var student map[string]any
+			var list []map[string]any
+			var page struct {
+				Data []map[string]any `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err == nil {
+				student = list[0]
+			} else if err := json.Unmarshal(rec.Body.Bytes(), &page); err == nil && page.Data != nil {
+				student = page.Data[0]
+			} else if err := json.Unmarshal(rec.Body.Bytes(), &student); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+
+			var keys []string
+			for k := range student {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("members %v, want %v", keys, tt.wantKeys)
+			}
+			for _, k := range []string{"display_name", "displayName"} {
+				if v, ok := student[k]; ok && v != "Ana (1301)" {
+					t.Errorf("%s = %v, want %q", k, v, "Ana (1301)")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type config struct {
+	// DBPath is the SQLite database file.
+	DBPath string
+	// APIKey guards the /admin routes; they are disabled when it is empty.
+	APIKey string
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set. TLSMinVersion
+	// is the oldest TLS version accepted then, a key of tlsVersions.
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSMinVersion string
+	// RequireIfMatch rejects updates and deletes without an If-Match header
+	// with 428.
+	RequireIfMatch bool
+	// RequireAccept rejects GET requests to the student routes without an
+	// Accept header with 406.
+	RequireAccept bool
+	// NIMScope is nimScopeGlobal when a NIM is unique across schools and
+	// nimScopeSchool when only within one.
+	NIMScope string
+	// RequireSchoolID rejects student requests without an X-School-Id
+	// header with 400. Single-tenant deployments turn it off, and their
+	// requests then act for the default school.
+	RequireSchoolID bool
+	// DefaultAddress is used for students created without an address and
+	// is what an address is reset to.
+	DefaultAddress string
+	// MaxDecompressedBody caps the inflated size of gzip request bodies.
+	MaxDecompressedBody int64
+	// MaxImportBody caps the body of the imports that are read into memory
+	// before they run: background and streamed ones.
+	MaxImportBody int64
+	// CompressThreshold is the size above which responses are gzipped; a
+	// negative threshold disables compression.
+	CompressThreshold int
+	// RequestTimeout bounds regular requests.
+	RequestTimeout time.Duration
+	// LongRequestTimeout bounds bulk operations such as imports.
+	LongRequestTimeout time.Duration
+	// QueryTimeout bounds every single query within a request.
+	QueryTimeout time.Duration
+	// SlowQueryLog enables logging of queries slower than SlowQueryThreshold.
+	SlowQueryLog       bool
+	SlowQueryThreshold time.Duration
+	// ExpectedAge is the plausible age range; listings containing students
+	// outside it carry a Warning header.
+	ExpectedAge ageRange
+	// TracingEndpoint is the OTLP/HTTP collector spans are exported to;
+	// tracing is disabled when it is empty.
+	TracingEndpoint string
+	// SLOBudget is the latency above which a request counts as an SLO
+	// breach; zero disables tracking. SLORouteBudgets overrides it per route,
+	// keyed by "METHOD /pattern" or "/pattern".
+	SLOBudget       time.Duration
+	SLORouteBudgets map[string]time.Duration
+	// NIMStrategy picks how NIMs are generated for students created without
+	// one: "random", "sequence" or "none" to keep requiring a NIM.
+	// Generated NIMs start with NIMPrefix.
+	NIMStrategy string
+	NIMPrefix   string
+	// NIMPattern is a regular expression new NIMs must match as a whole;
+	// any NIM is accepted when it is empty.
+	NIMPattern string
+	// CacheTTL is how long the stats and addresses aggregates are cached;
+	// zero disables caching.
+	CacheTTL time.Duration
+	// RejectDuplicateFields makes request bodies repeating a key in an
+	// object fail with 400. It costs an extra pass over the body.
+	RejectDuplicateFields bool
+	// DeprecatedRoutes lists the route patterns served at the root, such as
+	// /students/{nim}, whose responses carry a Deprecation header pointing
+	// clients to /api/v1; "*" flags all of them. SunsetDate, if set, is
+	// announced in a Sunset header.
+	DeprecatedRoutes []string
+	SunsetDate       time.Time
+	// DedupeWindow is how long an identical POST /students or
+	// /students/batch from the same client is answered with 409; zero
+	// disables deduplication.
+	DedupeWindow time.Duration
+	// DefaultSort orders listings.
+	DefaultSort sortOrder
+	// MaxBatchSize caps the number of students in one batch request, so a
+	// huge payload cannot hold the SQLite write lock for long.
+	MaxBatchSize int
+	// NIMCaseInsensitive makes lookups by NIM ignore ASCII case.
+	NIMCaseInsensitive bool
+	// Timezone decides where a day starts for GET /students/today.
+	Timezone *time.Location
+	// CohortPrefixLength is how many leading characters of a NIM, such as
+	// the year of entry, identify the cohort of a student.
+	CohortPrefixLength int
+	// HighlightPre and HighlightPost wrap the matches of ?q= in the
+	// highlights of a search.
+	HighlightPre  string
+	HighlightPost string
+	// ShutdownTimeout bounds how long shutdown waits for requests in
+	// flight to finish.
+	ShutdownTimeout time.Duration
+	// LogFormat is logFormatJSON for one JSON object per log line or
+	// logFormatText for lines meant to be read by people.
+	LogFormat string
+	// Debug enables diagnostics that must stay off in production, such as
+	// ?explain=true on listings.
+	Debug bool
+}
+
+func defaultConfig() config {
+	return config{
+		DBPath:                "./students.db",
+		RequireSchoolID:       true,
+		TLSMinVersion:         "1.2",
+		MaxDecompressedBody:   10 << 20,
+		MaxImportBody:         32 << 20,
+		CompressThreshold:     1024,
+		RequestTimeout:        5 * time.Second,
+		LongRequestTimeout:    60 * time.Second,
+		QueryTimeout:          2 * time.Second,
+		SlowQueryLog:          true,
+		SlowQueryThreshold:    100 * time.Millisecond,
+		ExpectedAge:           ageRange{Min: 15, Max: 100},
+		SLOBudget:             500 * time.Millisecond,
+		NIMStrategy:           nimStrategyRandom,
+		NIMScope:              nimScopeGlobal,
+		CacheTTL:              60 * time.Second,
+		RejectDuplicateFields: true,
+		MaxBatchSize:          1000,
+		Timezone:              time.UTC,
+		CohortPrefixLength:    4,
+		HighlightPre:          "<mark>",
+		HighlightPost:         "</mark>",
+		ShutdownTimeout:       30 * time.Second,
+		LogFormat:             logFormatJSON,
+	}
+}
+
+// loadConfig overlays environment variables on top of defaultConfig. A set
+// variable that cannot be parsed is an error rather than a silent fallback
+// to the default; every such variable is reported at once.
+func loadConfig() (config, error) {
+	d := defaultConfig()
+	var env envReader
+	cfg := config{
+		DBPath:              env.string("DB_PATH", d.DBPath),
+		APIKey:              env.string("API_KEY", d.APIKey),
+		TLSCertFile:         env.string("TLS_CERT_FILE", d.TLSCertFile),
+		TLSKeyFile:          env.string("TLS_KEY_FILE", d.TLSKeyFile),
+		TLSMinVersion:       env.string("TLS_MIN_VERSION", d.TLSMinVersion),
+		RequireIfMatch:      env.bool("REQUIRE_IF_MATCH", d.RequireIfMatch),
+		RequireSchoolID:     env.bool("REQUIRE_SCHOOL_ID", d.RequireSchoolID),
+		RequireAccept:       env.bool("REQUIRE_ACCEPT", d.RequireAccept),
+		NIMScope:            env.string("NIM_UNIQUE_PER", d.NIMScope),
+		DefaultAddress:      env.string("DEFAULT_ADDRESS", d.DefaultAddress),
+		MaxDecompressedBody: int64(env.int("MAX_DECOMPRESSED_BODY_BYTES", int(d.MaxDecompressedBody))),
+		MaxImportBody:       int64(env.int("MAX_IMPORT_BODY_BYTES", int(d.MaxImportBody))),
+		CompressThreshold:   env.int("COMPRESS_THRESHOLD_BYTES", d.CompressThreshold),
+		RequestTimeout:      env.duration("REQUEST_TIMEOUT", d.RequestTimeout),
+		LongRequestTimeout:  env.duration("LONG_REQUEST_TIMEOUT", d.LongRequestTimeout),
+		QueryTimeout:        env.duration("DB_QUERY_TIMEOUT", d.QueryTimeout),
+		SlowQueryLog:        env.bool("SLOW_QUERY_LOG", d.SlowQueryLog),
+		SlowQueryThreshold:  env.duration("SLOW_QUERY_THRESHOLD", d.SlowQueryThreshold),
+		ExpectedAge: ageRange{
+			Min: uint16(env.int("EXPECTED_AGE_MIN", int(d.ExpectedAge.Min))),
+			Max: uint16(env.int("EXPECTED_AGE_MAX", int(d.ExpectedAge.Max))),
+		},
+		TracingEndpoint:       env.string("OTEL_EXPORTER_OTLP_ENDPOINT", d.TracingEndpoint),
+		SLOBudget:             env.duration("SLO_BUDGET", d.SLOBudget),
+		SLORouteBudgets:       env.durationMap("SLO_ROUTE_BUDGETS", d.SLORouteBudgets),
+		NIMStrategy:           env.string("NIM_STRATEGY", d.NIMStrategy),
+		NIMPrefix:             env.string("NIM_PREFIX", d.NIMPrefix),
+		NIMPattern:            env.string("NIM_PATTERN", d.NIMPattern),
+		CacheTTL:              env.duration("CACHE_TTL", d.CacheTTL),
+		RejectDuplicateFields: env.bool("REJECT_DUPLICATE_FIELDS", d.RejectDuplicateFields),
+		DeprecatedRoutes:      env.list("DEPRECATED_ROUTES", d.DeprecatedRoutes),
+		SunsetDate:            env.date("SUNSET_DATE", d.SunsetDate),
+		DedupeWindow:          env.duration("DEDUPE_WINDOW", d.DedupeWindow),
+		DefaultSort:           env.sortOrder("DEFAULT_SORT", d.DefaultSort),
+		MaxBatchSize:          env.int("MAX_BATCH_SIZE", d.MaxBatchSize),
+		NIMCaseInsensitive:    env.bool("NIM_CASE_INSENSITIVE", d.NIMCaseInsensitive),
+		Timezone:              env.location("TIMEZONE", d.Timezone),
+		CohortPrefixLength:    env.int("COHORT_PREFIX_LENGTH", d.CohortPrefixLength),
+		HighlightPre:          env.string("HIGHLIGHT_PRE", d.HighlightPre),
+		HighlightPost:         env.string("HIGHLIGHT_POST", d.HighlightPost),
+		ShutdownTimeout:       env.duration("SHUTDOWN_TIMEOUT", d.ShutdownTimeout),
+		LogFormat:             env.logFormat("LOG_FORMAT", d.LogFormat),
+		Debug:                 env.bool("DEBUG", d.Debug),
+	}
+	return cfg, env.err()
+}
+
+// minAPIKeyLength is the shortest API_KEY accepted, so the admin routes are
+// not guarded by a guessable key.
+const minAPIKeyLength = 16
+
+// validate checks the settings the enabled features depend on and reports
+// every problem at once, so a misconfigured deployment fails at startup
+// with the whole list instead of one fix per restart.
+func (c config) validate() error {
+	var problems []string
+	if c.APIKey != "" && len(c.APIKey) < minAPIKeyLength {
+		problems = append(problems, fmt.Sprintf("API_KEY enables the admin routes and must be at least %d characters", minAPIKeyLength))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE enable TLS together; set both or neither")
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		if _, err := os.Stat(c.TLSCertFile); c.TLSCertFile != "" && err != nil {
+			problems = append(problems, fmt.Sprintf("TLS_CERT_FILE: %v", err))
+		}
+		if _, err := os.Stat(c.TLSKeyFile); c.TLSKeyFile != "" && err != nil {
+			problems = append(problems, fmt.Sprintf("TLS_KEY_FILE: %v", err))
+		}
+		if _, ok := tlsVersions[c.TLSMinVersion]; !ok {
+			problems = append(problems, fmt.Sprintf("TLS_MIN_VERSION must be %s, not %q", strings.Join(tlsVersionNames(), " or "), c.TLSMinVersion))
+		}
+	}
+	if _, ok := studentsPrimaryKeys[c.NIMScope]; !ok {
+		problems = append(problems, fmt.Sprintf("NIM_UNIQUE_PER must be %s or %s, not %q", nimScopeGlobal, nimScopeSchool, c.NIMScope))
+	}
+	switch c.NIMStrategy {
+	case nimStrategyRandom, nimStrategySequence, nimStrategyNone:
+	default:
+		problems = append(problems, fmt.Sprintf("NIM_STRATEGY must be %s, %s or %s, not %q", nimStrategyRandom, nimStrategySequence, nimStrategyNone, c.NIMStrategy))
+	}
+	if _, err := newNIMValidator(c.NIMPattern); err != nil {
+		problems = append(problems, fmt.Sprintf("NIM_PATTERN is not a valid regular expression: %v", err))
+	}
+	if c.TracingEndpoint != "" {
+		if u, err := url.Parse(c.TracingEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("OTEL_EXPORTER_OTLP_ENDPOINT enables tracing and must be an http or https URL, not %q", c.TracingEndpoint))
+		}
+	}
+	if c.ExpectedAge.Min > c.ExpectedAge.Max {
+		problems = append(problems, fmt.Sprintf("EXPECTED_AGE_MIN (%d) must not be above EXPECTED_AGE_MAX (%d)", c.ExpectedAge.Min, c.ExpectedAge.Max))
+	}
+	if c.MaxImportBody < 1 {
+		problems = append(problems, "MAX_IMPORT_BODY_BYTES must be at least 1")
+	}
+	if c.MaxBatchSize < 1 {
+		problems = append(problems, "MAX_BATCH_SIZE must be at least 1")
+	}
+	if c.CohortPrefixLength < 1 {
+		problems = append(problems, "COHORT_PREFIX_LENGTH must be at least 1")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// envReader reads configuration from environment variables, falling back
+// to a default for the ones that are not set and collecting a problem for
+// each one that is set but malformed.
+type envReader struct {
+	problems []string
+}
+
+func (e *envReader) invalid(key, v string, err error) {
+	e.problems = append(e.problems, fmt.Sprintf("%s=%q: %v", key, v, err))
+}
+
+// err returns the problems found so far, or nil.
+func (e *envReader) err() error {
+	if len(e.problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration: %s", strings.Join(e.problems, "; "))
+}
+
+func (e *envReader) string(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (e *envReader) bool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.invalid(key, v, fmt.Errorf("must be true or false"))
+		return fallback
+	}
+	return b
+}
+
+func (e *envReader) int(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.invalid(key, v, fmt.Errorf("must be an integer"))
+		return fallback
+	}
+	return n
+}
+
+func (e *envReader) duration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.invalid(key, v, fmt.Errorf("must be a duration such as 500ms or 2s"))
+		return fallback
+	}
+	return d
+}
+
+// list parses a comma separated list, dropping empty entries.
+func (e *envReader) list(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	var list []string
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// date parses a date such as 2027-06-30, taken as midnight UTC, or an RFC
+// 3339 timestamp.
+func (e *envReader) date(key string, fallback time.Time) time.Time {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t
+	}
+	e.invalid(key, v, fmt.Errorf("must be a date such as 2027-06-30 or an RFC 3339 timestamp"))
+	return fallback
+}
+
+// sortOrder parses a listing order such as -age.
+func (e *envReader) sortOrder(key string, fallback sortOrder) sortOrder {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	s, err := parseSortOrder(v)
+	if err != nil {
+		e.invalid(key, v, err)
+		return fallback
+	}
+	return s
+}
+
+// location loads an IANA time zone such as Asia/Jakarta.
+func (e *envReader) location(key string, fallback *time.Location) *time.Location {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		e.invalid(key, v, err)
+		return fallback
+	}
+	return loc
+}
+
+// logFormat reads logFormatText or logFormatJSON.
+func (e *envReader) logFormat(key string, fallback string) string {
+	v := os.Getenv(key)
+	switch v {
+	case "":
+		return fallback
+	case logFormatText, logFormatJSON:
+		return v
+	}
+	e.invalid(key, v, fmt.Errorf("must be %s or %s", logFormatText, logFormatJSON))
+	return fallback
+}
+
+// durationMap parses a comma separated list of key=duration pairs, such as
+// "GET /students=200ms,/students/import=30s".
+func (e *envReader) durationMap(key string, fallback map[string]time.Duration) map[string]time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	m := map[string]time.Duration{}
+	for _, entry := range strings.Split(v, ",") {
+		k, d, ok := strings.Cut(entry, "=")
+		if !ok {
+			e.invalid(key, v, fmt.Errorf("entry %q is not key=duration", entry))
+			continue
+		}
+		dur, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			e.invalid(key, v, fmt.Errorf("entry %q does not end in a duration", entry))
+			continue
+		}
+		m[strings.TrimSpace(k)] = dur
+	}
+	return m
+}
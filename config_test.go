@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.WriteFile(f, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*config)
+		want   []string
+	}{
+		{"defaults", func(c *config) {}, nil},
+		{"admin routes with a strong key", func(c *config) { c.APIKey = strings.Repeat("k", minAPIKeyLength) }, nil},
+		{"admin routes with a short key", func(c *config) { c.APIKey = "secret" }, []string{"API_KEY"}},
+		{"tracing without a URL", func(c *config) { c.TracingEndpoint = "collector:4318" }, []string{"OTEL_EXPORTER_OTLP_ENDPOINT"}},
+		{"tracing with a URL", func(c *config) { c.TracingEndpoint = "http://collector:4318" }, nil},
+		{"TLS without a key", func(c *config) { c.TLSCertFile = certFile }, []string{"TLS_KEY_FILE"}},
+		{"TLS without a certificate", func(c *config) { c.TLSKeyFile = keyFile }, []string{"TLS_CERT_FILE"}},
+		{"TLS with missing files", func(c *config) {
+			c.TLSCertFile = filepath.Join(dir, "missing.crt")
+			c.TLSKeyFile = filepath.Join(dir, "missing.key")
+		}, []string{"TLS_CERT_FILE", "TLS_KEY_FILE"}},
+		{"TLS 1.1", func(c *config) {
+			c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+			c.TLSMinVersion = "1.1"
+		}, []string{"TLS_MIN_VERSION"}},
+		{"TLS", func(c *config) { c.TLSCertFile, c.TLSKeyFile = certFile, keyFile }, nil},
+		{"TLS version without TLS", func(c *config) { c.TLSMinVersion = "1.1" }, nil},
+		{"every problem at once", func(c *config) {
+			c.APIKey = "secret"
+			c.NIMScope = "class"
+			c.NIMStrategy = "uuid"
+			c.ExpectedAge = ageRange{Min: 30, Max: 20}
+			c.MaxBatchSize = 0
+			c.CohortPrefixLength = 0
+		}, []string{"API_KEY", "NIM_UNIQUE_PER", "NIM_STRATEGY", "EXPECTED_AGE_MIN", "MAX_BATCH_SIZE", "COHORT_PREFIX_LENGTH"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(&cfg)
+
+			err := cfg.validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate accepted the configuration, want errors on %v", tt.want)
+			}
+			for _, name := range tt.want {
+				if !strings.Contains(err.Error(), name) {
+					t.Errorf("error %q does not name %s", err, name)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsMalformedValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string
+	}{
+		{"defaults", nil, nil},
+		{"valid values", map[string]string{"DB_QUERY_TIMEOUT": "5s", "CACHE_TTL": "0", "MAX_BATCH_SIZE": "10", "DEBUG": "true"}, nil},
+		{"malformed duration", map[string]string{"DB_QUERY_TIMEOUT": "5x"}, []string{"DB_QUERY_TIMEOUT"}},
+		{"malformed integer", map[string]string{"MAX_BATCH_SIZE": "ten"}, []string{"MAX_BATCH_SIZE"}},
+		{"malformed bool", map[string]string{"REQUIRE_SCHOOL_ID": "nope"}, []string{"REQUIRE_SCHOOL_ID"}},
+		{"malformed date", map[string]string{"SUNSET_DATE": "next year"}, []string{"SUNSET_DATE"}},
+		{"malformed route budget", map[string]string{"SLO_ROUTE_BUDGETS": "/students=fast"}, []string{"SLO_ROUTE_BUDGETS"}},
+		{"unknown time zone", map[string]string{"TIMEZONE": "Mars/Olympus"}, []string{"TIMEZONE"}},
+		{"every problem at once", map[string]string{"DB_QUERY_TIMEOUT": "5x", "CACHE_TTL": "abc", "COMPRESS_THRESHOLD_BYTES": "1k"},
+			[]string{"DB_QUERY_TIMEOUT", "CACHE_TTL", "COMPRESS_THRESHOLD_BYTES"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := loadConfig()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("loadConfig: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("loadConfig accepted %v, want an error", tt.env)
+			}
+			for _, key := range tt.wantErr {
+				if !strings.Contains(err.Error(), key) {
+					t.Errorf("error %q does not name %s", err, key)
+				}
+			}
+			// The rest of the configuration is still read.
+			if cfg.RequestTimeout != 5*time.Second {
+				t.Errorf("RequestTimeout = %s, want the default", cfg.RequestTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,1191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type Student struct {
+	NIM     string `json:"nim"`
+	Name    string `json:"name"`
+	Age     uint16 `json:"age"`
+	Address string `json:"address"`
+	// CreatedAt and UpdatedAt are maintained by the datastore; values sent
+	// by clients are ignored. They are nil for rows written around the API
+	// without them, and sent as null then.
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+var errDataNotFound = errors.New("data not found")
+var errInternalServer = errors.New("internal server error")
+var errSchemaUnavailable = errors.New("students table is unavailable")
+
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Prepare(query string) (*loggedStmt, error)
+	Query(query string, args ...any) (*loggedRows, error)
+	QueryRow(query string, args ...any) *loggedRow
+}
+
+// sqlConn is implemented by both *sql.DB and *sql.Tx.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type Datastore struct {
+	// StudentMap map[string]Student
+	StudentSQLite *sql.DB
+
+	tx  *sql.Tx
+	ctx context.Context
+	// slowQuery is the duration above which queries are logged; zero
+	// disables slow query logging.
+	slowQuery time.Duration
+	// queryTimeout bounds every query; zero leaves queries to the deadline
+	// of the context alone.
+	queryTimeout time.Duration
+	// nimNoCase makes lookups by NIM ignore ASCII case.
+	nimNoCase bool
+	// school is the tenant every query is scoped to. The empty school holds
+	// the students of single-tenant deployments and rows from before
+	// tenants existed.
+	school string
+	// nimScope is the scope within which NIMs are unique, which the
+	// schema has to be recreated with.
+	nimScope string
+	// lookups coalesces concurrent FindByNIM calls for the same student
+	// outside transactions.
+	lookups *flightGroup[Student]
+	// windowFunctions is set when the SQLite build supports COUNT(*) OVER(),
+	// which lets FindAll fetch a page and the total in one query.
+	windowFunctions bool
+}
+
+// createStudentsTable creates the table with studentsChecks, so a fresh
+// database does not need rebuildStudents to add them.
+var createStudentsTable = `create table if not exists students (nim text not null primary key, name text not null, age INTEGER not null, address TEXT not null, created_at TEXT, updated_at TEXT, ` + studentsChecks + `);`
+
+const studentColumns = "nim, name, age, address, created_at, updated_at"
+
+// timestampLayout is how created_at and updated_at are stored: fixed width
+// UTC, so that comparing the strings compares the times.
+const timestampLayout = "2006-01-02T15:04:05.000Z"
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// formatStoredTimestamp formats a timestamp that may be missing as the
+// empty string.
+func formatStoredTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTimestamp(*t)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanStudent scans a row selected with studentColumns, followed by extra.
+func scanStudent(row scanner, extra ...any) (Student, error) {
+	var student Student
+	var createdAt, updatedAt sql.NullString
+	dest := []any{&student.NIM, &student.Name, &student.Age, &student.Address, &createdAt, &updatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return Student{}, err
+	}
+
+	student.CreatedAt = parseStoredTimestamp(createdAt)
+	student.UpdatedAt = parseStoredTimestamp(updatedAt)
+	return student, nil
+}
+
+// parseStoredTimestamp parses a timestamp column, returning nil for NULL or
+// a value not written by formatTimestamp.
+func parseStoredTimestamp(v sql.NullString) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t, err := time.Parse(timestampLayout, v.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// newDatastore opens the SQLite database at path, verifies the file accepts
+// writes so misconfiguration surfaces at startup and migrates the schema.
+//
+// path may be ":memory:" for tests. Every connection to an in-memory
+// database gets its own empty database, so the pool is limited to a single
+// connection that is never closed; otherwise tables created by the
+// migrations would vanish as soon as another connection is used. The
+// flip side is that code holding a transaction must not query through the
+// pool at the same time, or it waits forever for the only connection.
+//
+// nimScope, nimScopeGlobal or nimScopeSchool, decides whether a NIM is unique
+// across all schools or within one; the table is rebuilt when it was created
+// for the other scope.
+func newDatastore(path string, nimScope string) (*Datastore, error) {
+	db, err := sql.Open(sqliteDriver, immediateTxDSN(path))
+	if err != nil {
+		return nil, err
+	}
+
+	// Open only checks its arguments; Ping makes the driver open the file,
+	// so a database that cannot be opened fails here at startup rather
+	// than on the first request.
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot open database %s with driver %s: %w", path, sqliteDriver, err)
+	}
+
+	if isMemoryDSN(path) {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	}
+
+	if err := probeWritable(db); err != nil {
+		db.Close()
+		if strings.Contains(err.Error(), "readonly") {
+			return nil, fmt.Errorf("database %s is not writable, check file and directory permissions: %w", path, err)
+		}
+		return nil, fmt.Errorf("database %s failed write check: %w", path, err)
+	}
+
+	if err := migrate(context.Background(), db, nimScope); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Datastore{
+		StudentSQLite:   db,
+		nimScope:        nimScope,
+		lookups:         newFlightGroup[Student](),
+		windowFunctions: supportsWindowFunctions(db),
+	}, nil
+}
+
+// immediateTxDSN returns path with every transaction set to start with
+// BEGIN IMMEDIATE, unless it chooses a locking mode itself. A deferred
+// transaction only asks for the write lock at its first write, so two
+// requests that both read a student before updating it would each hold a
+// read lock the other waits on, and one of them fails with "database is
+// locked". Taking the write lock up front makes the second wait its turn,
+// up to the driver's busy timeout, and then read what the first wrote.
+// All transactions here are opened to write.
+func immediateTxDSN(path string) string {
+	if strings.Contains(path, "_txlock=") {
+		return path
+	}
+	if strings.Contains(path, "?") {
+		return path + "&_txlock=immediate"
+	}
+	return path + "?_txlock=immediate"
+}
+
+// isMemoryDSN reports whether path names a private in-memory database,
+// either ":memory:" or a file: URI with mode=memory. Shared-cache URIs are
+// excluded since their connections all see the same database.
+func isMemoryDSN(path string) bool {
+	if path == ":memory:" || strings.HasPrefix(path, ":memory:?") {
+		return true
+	}
+	return strings.HasPrefix(path, "file:") &&
+		(strings.Contains(path, ":memory:") || strings.Contains(path, "mode=memory")) &&
+		!strings.Contains(path, "cache=shared")
+}
+
+func supportsWindowFunctions(db *sql.DB) bool {
+	var n int
+	return db.QueryRow("SELECT COUNT(*) OVER ()").Scan(&n) == nil
+}
+
+// probeWritable performs a throwaway write inside a transaction that is
+// always rolled back, so the database file is left untouched.
+func probeWritable(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("CREATE TABLE write_probe (id INTEGER)")
+	return err
+}
+
+// Ping checks that the database can be reached.
+func (ds *Datastore) Ping() error {
+	return ds.StudentSQLite.PingContext(ds.context())
+}
+
+// CheckWritable runs the startup write probe again, to detect a database
+// that turned read-only while the service was running.
+func (ds *Datastore) CheckWritable() error {
+	return probeWritable(ds.StudentSQLite)
+}
+
+// WithTx returns a copy of the datastore whose queries run inside tx.
+func (ds *Datastore) WithTx(tx *sql.Tx) *Datastore {
+	txds := *ds
+	txds.tx = tx
+	return &txds
+}
+
+// WithContext returns a copy of the datastore whose queries run with ctx, so
+// they are cancelled together with the request that issued them.
+func (ds *Datastore) WithContext(ctx context.Context) *Datastore {
+	ctxds := *ds
+	ctxds.ctx = ctx
+	return &ctxds
+}
+
+// ForSchool returns a copy of the datastore that only sees and writes the
+// students of school.
+func (ds *Datastore) ForSchool(school string) *Datastore {
+	sds := *ds
+	sds.school = school
+	return &sds
+}
+
+// LogSlowQueries logs every query that takes longer than threshold. A zero
+// threshold turns logging off.
+func (ds *Datastore) LogSlowQueries(threshold time.Duration) {
+	ds.slowQuery = threshold
+}
+
+// LimitQueries bounds every query, except the scans streaming exports and
+// maintenance statements such as VACUUM, to timeout, however long the
+// request running it may take. A zero timeout removes the limit.
+func (ds *Datastore) LimitQueries(timeout time.Duration) {
+	ds.queryTimeout = timeout
+}
+
+// IgnoreNIMCase makes lookups, updates and deletes by NIM match regardless
+// of ASCII case, for NIMs entered with inconsistent casing upstream. NIMs
+// stay unique only case-sensitively, so if both ABC123 and abc123 are
+// stored a lookup returns either one and an update or delete affects both.
+// Non-ASCII letters are still compared exactly.
+func (ds *Datastore) IgnoreNIMCase() {
+	ds.nimNoCase = true
+}
+
+// nimMatch returns the condition selecting a student of the datastore's
+// school by NIM. It binds two parameters, the NIM followed by ds.school.
+func (ds *Datastore) nimMatch() string {
+	if ds.nimNoCase {
+		return "nim = ? COLLATE NOCASE AND school_id = ?"
+	}
+	return "nim = ? AND school_id = ?"
+}
+
+// nimIn returns the condition selecting the students of the datastore's
+// school whose NIM is one of n. It binds the n NIMs followed by ds.school.
+func (ds *Datastore) nimIn(n int) string {
+	column := "nim"
+	if ds.nimNoCase {
+		column = "nim COLLATE NOCASE"
+	}
+	return column + " IN (" + placeholders(n) + ") AND school_id = ?"
+}
+
+// where returns the WHERE clause, with a leading space, selecting the
+// students of the datastore's school that match f, and its arguments.
+func (ds *Datastore) where(f studentFilter) (string, []any) {
+	conds, args := f.conditions()
+	conds = append([]string{"school_id = ?"}, conds...)
+	args = append([]any{ds.school}, args...)
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (ds *Datastore) context() context.Context {
+	if ds.ctx != nil {
+		return ds.ctx
+	}
+	return context.Background()
+}
+
+// conn returns the connection queries should use: the current transaction
+// if there is one, the pool otherwise.
+func (ds *Datastore) conn() dbtx {
+	return &loggedConn{base: ds.rawConn(), ctx: ds.context(), slow: ds.slowQuery, timeout: ds.queryTimeout}
+}
+
+func (ds *Datastore) rawConn() sqlConn {
+	if ds.tx != nil {
+		return ds.tx
+	}
+	return ds.StudentSQLite
+}
+
+// pool returns the connection pool even inside a transaction, for
+// statements such as VACUUM that cannot run in one. Those take as long as
+// the database is big, so the query timeout does not apply.
+func (ds *Datastore) pool() dbtx {
+	return &loggedConn{base: ds.StudentSQLite, ctx: ds.context(), slow: ds.slowQuery}
+}
+
+func (ds *Datastore) Save(student Student) error {
+	return retrySchema(ds, func() error {
+		return ds.save(student)
+	})
+}
+
+func (ds *Datastore) save(student Student) error {
+	now := formatTimestamp(time.Now())
+	_, err := ds.conn().Exec("INSERT INTO students(nim, name, age, address, created_at, updated_at, school_id) values(?,?,?,?,?,?,?)",
+		student.NIM, student.Name, student.Age, student.Address, now, now, ds.school)
+	return err
+}
+
+// errCommitFailed means every row of a batch was inserted but the
+// transaction could not be committed, so none of them was stored.
+var errCommitFailed = errors.New("commit failed, no rows were saved")
+
+// SaveBatch inserts all students atomically: either every row is stored or
+// none is. Success is only reported once the transaction has committed; a
+// failing row is reported as "insert failed at row i", a failing commit as
+// errCommitFailed. Inside a request-scoped transaction it joins that
+// transaction, which then decides about the commit.
+func (ds *Datastore) SaveBatch(students []Student) error {
+	return retrySchema(ds, func() error {
+		return ds.saveBatch(students)
+	})
+}
+
+func (ds *Datastore) saveBatch(students []Student) error {
+	if ds.tx != nil {
+		return saveAll(ds.conn(), students, ds.school)
+	}
+
+	tx, err := ds.StudentSQLite.BeginTx(ds.context(), nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction is a no-op.
+	defer tx.Rollback()
+
+	if err := saveAll(ds.WithTx(tx).conn(), students, ds.school); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", errCommitFailed, err)
+	}
+	return nil
+}
+
+func saveAll(conn dbtx, students []Student, school string) error {
+	stmt, err := conn.Prepare("INSERT INTO students(nim, name, age, address, created_at, updated_at, school_id) values(?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := formatTimestamp(time.Now())
+	for i, student := range students {
+		_, err = stmt.Exec(student.NIM, student.Name, student.Age, student.Address, now, now, school)
+		if err != nil {
+			return fmt.Errorf("insert failed at row %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (ds *Datastore) DeleteByNIM(nim string) error {
+	return retrySchema(ds, func() error {
+		return ds.deleteByNIM(nim)
+	})
+}
+
+func (ds *Datastore) deleteByNIM(nim string) error {
+	sqlStatement := `DELETE FROM students WHERE ` + ds.nimMatch() + `;`
+	_, err := ds.conn().Exec(sqlStatement, nim, ds.school)
+	return err
+}
+
+// DeleteByNIMs deletes the students with the given NIMs and returns how many
+// there were. Inside a request-scoped transaction it joins that transaction.
+func (ds *Datastore) DeleteByNIMs(nims []string) (int, error) {
+	return withSchemaRetry(ds, func() (int, error) {
+		return ds.deleteByNIMs(nims)
+	})
+}
+
+func (ds *Datastore) deleteByNIMs(nims []string) (int, error) {
+	deleted := 0
+	for _, chunk := range chunkNIMs(nims) {
+		res, err := ds.conn().Exec("DELETE FROM students WHERE "+ds.nimIn(len(chunk)), nimArgs(chunk, ds.school)...)
+		if err != nil {
+			return deleted, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+	return deleted, nil
+}
+
+// UpdateByNIM updates the student with student's NIM and returns how many
+// rows changed, 0 when there is no such student. With NIM_CASE_INSENSITIVE
+// it can be more than one. Unless it joins a request-scoped transaction it
+// runs in one of its own; either way the transaction takes the write lock
+// as it begins, so concurrent updates of a student are applied one after
+// the other.
+func (ds *Datastore) UpdateByNIM(student Student) (int64, error) {
+	return withSchemaRetry(ds, func() (int64, error) {
+		return ds.updateByNIM(student)
+	})
+}
+
+func (ds *Datastore) updateByNIM(student Student) (int64, error) {
+	if ds.tx == nil {
+		tx, err := ds.StudentSQLite.BeginTx(ds.context(), nil)
+		if err != nil {
+			return 0, err
+		}
+		n, err := ds.WithTx(tx).updateByNIM(student)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		return n, tx.Commit()
+	}
+
+	stmt, err := ds.conn().Prepare("UPDATE students SET name = ?, age = ?, address = ?, updated_at = ? WHERE " + ds.nimMatch())
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(student.Name, student.Age, student.Address, formatTimestamp(time.Now()), student.NIM, ds.school)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UpdateBatch updates every student by NIM in one transaction and returns
+// the NIMs that matched no row. In strict mode any such NIM rolls the whole
+// batch back and errDataNotFound is returned; otherwise they are skipped.
+// Inside a request-scoped transaction it joins that transaction and leaves
+// the rollback to it.
+func (ds *Datastore) UpdateBatch(students []Student, strict bool) ([]string, error) {
+	return withSchemaRetry(ds, func() ([]string, error) {
+		return ds.updateBatch(students, strict)
+	})
+}
+
+func (ds *Datastore) updateBatch(students []Student, strict bool) ([]string, error) {
+	if ds.tx != nil {
+		notFound, err := updateAll(ds.conn(), students, ds.nimMatch(), ds.school)
+		if err == nil && strict && len(notFound) > 0 {
+			err = errDataNotFound
+		}
+		return notFound, err
+	}
+
+	tx, err := ds.StudentSQLite.BeginTx(ds.context(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	notFound, err := ds.WithTx(tx).updateBatch(students, strict)
+	if err != nil {
+		tx.Rollback()
+		return notFound, err
+	}
+
+	return notFound, tx.Commit()
+}
+
+func updateAll(conn dbtx, students []Student, nimMatch string, school string) ([]string, error) {
+	stmt, err := conn.Prepare("UPDATE students SET name = ?, age = ?, address = ?, updated_at = ? WHERE " + nimMatch)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	notFound := []string{}
+	now := formatTimestamp(time.Now())
+	for i, student := range students {
+		res, err := stmt.Exec(student.Name, student.Age, student.Address, now, student.NIM, school)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		if n == 0 {
+			notFound = append(notFound, student.NIM)
+		}
+	}
+
+	return notFound, nil
+}
+
+// ResetAddress sets the student's address to address and returns the
+// updated student.
+func (ds *Datastore) ResetAddress(nim string, address string) (Student, error) {
+	return withSchemaRetry(ds, func() (Student, error) {
+		return ds.resetAddress(nim, address)
+	})
+}
+
+func (ds *Datastore) resetAddress(nim string, address string) (Student, error) {
+	return ds.updateField(nim, "address", address)
+}
+
+// updatableColumns are the columns UpdateField may set.
+var updatableColumns = map[string]bool{"name": true, "age": true, "address": true}
+
+// UpdateField sets a single column of the student to value and returns the
+// updated student. column must be one of updatableColumns; the NIM cannot
+// be changed.
+func (ds *Datastore) UpdateField(nim string, column string, value any) (Student, error) {
+	return withSchemaRetry(ds, func() (Student, error) {
+		return ds.updateField(nim, column, value)
+	})
+}
+
+func (ds *Datastore) updateField(nim string, column string, value any) (Student, error) {
+	if !updatableColumns[column] {
+		return Student{}, fmt.Errorf("column %q cannot be updated", column)
+	}
+
+	res, err := ds.conn().Exec("UPDATE students SET "+column+" = ?, updated_at = ? WHERE "+ds.nimMatch(), value, formatTimestamp(time.Now()), nim, ds.school)
+	if err != nil {
+		return Student{}, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Student{}, err
+	}
+	if n == 0 {
+		return Student{}, errDataNotFound
+	}
+
+	return ds.findByNIM(nim)
+}
+
+// RenameNIM moves the student with NIM nim to newNIM and returns it. The
+// primary key itself enforces that newNIM is free within the NIM scope, so
+// a taken NIM fails with a constraint error rather than being checked first
+// and racing with a concurrent insert. No other table refers to the NIM, so
+// the row is all there is to move.
+func (ds *Datastore) RenameNIM(nim, newNIM string) (Student, error) {
+	return withSchemaRetry(ds, func() (Student, error) {
+		return ds.renameNIM(nim, newNIM)
+	})
+}
+
+func (ds *Datastore) renameNIM(nim, newNIM string) (Student, error) {
+	res, err := ds.conn().Exec("UPDATE students SET nim = ?, updated_at = ? WHERE "+ds.nimMatch(), newNIM, formatTimestamp(time.Now()), nim, ds.school)
+	if err != nil {
+		return Student{}, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Student{}, err
+	}
+	if n == 0 {
+		return Student{}, errDataNotFound
+	}
+
+	return ds.findByNIM(newNIM)
+}
+
+type ageRange struct {
+	Min uint16
+	Max uint16
+}
+
+func (a ageRange) contains(age uint16) bool {
+	return age >= a.Min && age <= a.Max
+}
+
+type listQuery struct {
+	// Limit caps the students returned; a negative Limit returns them all.
+	Limit  int
+	Offset int
+	Filter studentFilter
+	Sort   sortOrder
+	// ExpectedAge is used to count students with a suspicious age.
+	ExpectedAge ageRange
+}
+
+type listResult struct {
+	Students  []Student
+	Total     int
+	Anomalies int
+}
+
+// FindAll returns one page of students together with the total number of
+// students and how many on the page have an age outside q.ExpectedAge, which
+// flags legacy rows with suspicious data.
+func (ds *Datastore) FindAll(q listQuery) (listResult, error) {
+	return withSchemaRetry(ds, func() (listResult, error) {
+		return ds.findAll(q)
+	})
+}
+
+// pageQuery returns the query FindAll fetches a page with and its arguments.
+func (ds *Datastore) pageQuery(q listQuery) (string, []any) {
+	where, args := ds.where(q.Filter)
+
+	// Without an ORDER BY the order of rows is up to SQLite and may change
+	// between versions or query plans, shuffling pages. Searches put the
+	// best matches first and use the sort order among equally good ones.
+	var rank []string
+	if q.Filter.Query != "" {
+		term, rankArgs := searchRank(q.Filter.Query)
+		rank = append(rank, term)
+		args = append(args, rankArgs...)
+	}
+	tail := where + q.Sort.orderBy(rank...) + " LIMIT ? OFFSET ?"
+
+	query := "SELECT " + studentColumns + " FROM students" + tail
+	if ds.windowFunctions {
+		query = "SELECT " + studentColumns + ", COUNT(*) OVER () FROM students" + tail
+	}
+	return query, append(args, q.Limit, q.Offset)
+}
+
+func (ds *Datastore) findAll(q listQuery) (listResult, error) {
+	result := listResult{Students: []Student{}}
+
+	where, args := ds.where(q.Filter)
+
+	query, pageArgs := ds.pageQuery(q)
+	rows, err := ds.conn().Query(query, pageArgs...)
+	if err != nil {
+		return listResult{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var extra []any
+		if ds.windowFunctions {
+			extra = append(extra, &result.Total)
+		}
+		student, err := scanStudent(rows, extra...)
+		if err != nil {
+			return listResult{}, err
+		}
+		if !q.ExpectedAge.contains(student.Age) {
+			result.Anomalies++
+		}
+		result.Students = append(result.Students, student)
+	}
+	if err := rows.Err(); err != nil {
+		return listResult{}, err
+	}
+
+	// Without window functions, or when the page is past the end and no row
+	// carried the total, fall back to a separate COUNT.
+	if !ds.windowFunctions || len(result.Students) == 0 {
+		err = ds.conn().QueryRow("SELECT COUNT(*) FROM students"+where, args...).Scan(&result.Total)
+		if err != nil {
+			return listResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// Count returns how many students match f.
+func (ds *Datastore) Count(f studentFilter) (int, error) {
+	return withSchemaRetry(ds, func() (int, error) {
+		return ds.count(f)
+	})
+}
+
+func (ds *Datastore) count(f studentFilter) (int, error) {
+	where, args := ds.where(f)
+	var n int
+	err := ds.conn().QueryRow("SELECT COUNT(*) FROM students"+where, args...).Scan(&n)
+	return n, err
+}
+
+type queryPlanStep struct {
+	ID     int    `json:"id"`
+	Parent int    `json:"parent"`
+	Detail string `json:"detail"`
+}
+
+// ExplainFindAll returns SQLite's plan for the query FindAll would run for q
+// without running it.
+func (ds *Datastore) ExplainFindAll(q listQuery) ([]queryPlanStep, error) {
+	return withSchemaRetry(ds, func() ([]queryPlanStep, error) {
+		return ds.explainFindAll(q)
+	})
+}
+
+func (ds *Datastore) explainFindAll(q listQuery) ([]queryPlanStep, error) {
+	query, args := ds.pageQuery(q)
+	rows, err := ds.conn().Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plan := []queryPlanStep{}
+	for rows.Next() {
+		var step queryPlanStep
+		var unused int
+		if err := rows.Scan(&step.ID, &step.Parent, &unused, &step.Detail); err != nil {
+			return nil, err
+		}
+		plan = append(plan, step)
+	}
+	return plan, rows.Err()
+}
+
+// FindByNIM returns the student with the given NIM. Concurrent lookups of
+// the same NIM outside a transaction share one query; a transaction has to
+// see its own writes, so it always queries.
+func (ds *Datastore) FindByNIM(nim string) (Student, error) {
+	student, err := withSchemaRetry(ds, func() (Student, error) {
+		if ds.tx != nil || ds.lookups == nil {
+			return ds.findByNIM(nim)
+		}
+		return ds.findByNIMShared(nim)
+	})
+	if err != nil && !errors.Is(err, errDataNotFound) {
+		if isMissingTable(err) {
+			return Student{}, errSchemaUnavailable
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return Student{}, err
+		}
+		return Student{}, errInternalServer
+	}
+
+	return student, err
+}
+
+// findByNIMShared runs findByNIM through ds.lookups. The query runs with the
+// context of whichever caller came first, so a caller that gets that
+// caller's cancellation while its own context is still live queries again.
+func (ds *Datastore) findByNIMShared(nim string) (Student, error) {
+	key := ds.school + "\x00" + nim
+	student, err, shared := ds.lookups.do(key, func() (Student, error) {
+		return ds.findByNIM(nim)
+	})
+	if shared && isContextError(err) && ds.context().Err() == nil {
+		return ds.findByNIM(nim)
+	}
+	return student, err
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (ds *Datastore) findByNIM(nim string) (Student, error) {
+	sqlStatement := `SELECT ` + studentColumns + ` FROM students WHERE ` + ds.nimMatch() + `;`
+	row := ds.conn().QueryRow(sqlStatement, nim, ds.school)
+	student, err := scanStudent(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Student{}, errDataNotFound
+		}
+		return Student{}, err
+	}
+
+	return student, nil
+}
+
+// FindByNIMs returns the students with the given NIMs in NIM order. NIMs
+// without a student are left out.
+func (ds *Datastore) FindByNIMs(nims []string) ([]Student, error) {
+	return withSchemaRetry(ds, func() ([]Student, error) {
+		return ds.findByNIMs(nims)
+	})
+}
+
+func (ds *Datastore) findByNIMs(nims []string) ([]Student, error) {
+	students := []Student{}
+	for _, chunk := range chunkNIMs(nims) {
+		rows, err := ds.conn().Query("SELECT "+studentColumns+" FROM students WHERE "+ds.nimIn(len(chunk)), nimArgs(chunk, ds.school)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			student, err := scanStudent(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			students = append(students, student)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Chunks are queried one after another, so sort across them. A NIM sent
+	// twice in different chunks, or in two casings with IgnoreNIMCase,
+	// matches the same row more than once.
+	sort.Slice(students, func(i, j int) bool { return students[i].NIM < students[j].NIM })
+	unique := students[:0]
+	for i, student := range students {
+		if i == 0 || student.NIM != students[i-1].NIM {
+			unique = append(unique, student)
+		}
+	}
+	return unique, nil
+}
+
+// maxNIMsPerQuery is how many NIMs one IN list binds. SQLite builds before
+// 3.32 allow only 999 bound variables per statement; this leaves room for the
+// others.
+const maxNIMsPerQuery = 900
+
+// chunkNIMs splits nims into lists short enough for one IN clause.
+func chunkNIMs(nims []string) [][]string {
+	var chunks [][]string
+	for len(nims) > maxNIMsPerQuery {
+		chunks = append(chunks, nims[:maxNIMsPerQuery])
+		nims = nims[maxNIMsPerQuery:]
+	}
+	if len(nims) > 0 {
+		chunks = append(chunks, nims)
+	}
+	return chunks
+}
+
+// nimArgs returns the arguments for nimIn.
+func nimArgs(nims []string, school string) []any {
+	args := make([]any, 0, len(nims)+1)
+	for _, nim := range nims {
+		args = append(args, nim)
+	}
+	return append(args, school)
+}
+
+// EachStudent calls fn for every student matching f, in NIM order, without
+// holding them all in memory. It stops at the first error fn returns.
+func (ds *Datastore) EachStudent(f studentFilter, fn func(Student) error) error {
+	return retrySchema(ds, func() error {
+		return ds.eachStudent(f, fn)
+	})
+}
+
+func (ds *Datastore) eachStudent(f studentFilter, fn func(Student) error) error {
+	where, args := ds.where(f)
+	// The scan lasts as long as the client takes to read the export, so
+	// only the request deadline bounds it.
+	conn := &loggedConn{base: ds.rawConn(), ctx: ds.context(), slow: ds.slowQuery}
+	rows, err := conn.Query("SELECT "+studentColumns+" FROM students"+where+" ORDER BY nim", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		student, err := scanStudent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(student); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// weightColumns are the numeric columns random picks can be weighted by.
+var weightColumns = []string{"age"}
+
+// FindRandom returns up to n distinct students picked at random. With a
+// weight column, each pick favors students in proportion to its value, and
+// students whose value is not positive are never picked.
+func (ds *Datastore) FindRandom(n int, weight string) ([]Student, error) {
+	return withSchemaRetry(ds, func() ([]Student, error) {
+		return ds.findRandom(n, weight)
+	})
+}
+
+func (ds *Datastore) findRandom(n int, weight string) ([]Student, error) {
+	query := "SELECT " + studentColumns + " FROM students WHERE school_id = ? ORDER BY RANDOM() LIMIT ?"
+	if weight != "" {
+		if !containsString(weightColumns, weight) {
+			return nil, fmt.Errorf("column %q cannot weigh random picks", weight)
+		}
+		query = "SELECT " + studentColumns + " FROM students WHERE school_id = ? AND " + weight + " > 0 ORDER BY weighted_rank(RANDOM(), CAST(" + weight + " AS REAL)) LIMIT ?"
+	}
+
+	rows, err := ds.conn().Query(query, ds.school, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := []Student{}
+	for rows.Next() {
+		student, err := scanStudent(rows)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, student)
+	}
+	return students, rows.Err()
+}
+
+// similarAgeRange is how many years apart two students may be and still
+// count as similar.
+const similarAgeRange = 2
+
+// FindSimilar returns up to n other students of the school living at the
+// same address as the student with the given NIM or within
+// similarAgeRange years of their age. Those sharing the address come first,
+// then the closest in age. It returns errDataNotFound when there is no such
+// student.
+func (ds *Datastore) FindSimilar(nim string, n int) ([]Student, error) {
+	return withSchemaRetry(ds, func() ([]Student, error) {
+		return ds.findSimilar(nim, n)
+	})
+}
+
+func (ds *Datastore) findSimilar(nim string, n int) ([]Student, error) {
+	columns := "s." + strings.ReplaceAll(studentColumns, ", ", ", s.")
+	rows, err := ds.conn().Query(`SELECT `+columns+` FROM (SELECT nim, school_id, age, address FROM students WHERE `+ds.nimMatch()+`) b
+		JOIN students s ON s.school_id = b.school_id AND s.nim <> b.nim
+			AND (s.address = b.address OR s.age BETWEEN b.age - ? AND b.age + ?)
+		ORDER BY s.address = b.address DESC, ABS(s.age - b.age), s.nim LIMIT ?`,
+		nim, ds.school, similarAgeRange, similarAgeRange, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := []Student{}
+	for rows.Next() {
+		student, err := scanStudent(rows)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, student)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// No match can also mean no such student, which only costs a lookup
+	// when there is nothing to return.
+	if len(students) == 0 {
+		if _, err := ds.findByNIM(nim); err != nil {
+			return nil, err
+		}
+	}
+	return students, nil
+}
+
+// LastNIMSequence returns the highest number n such that prefix followed by
+// the digits of n is a stored NIM, or 0 when there is none. It looks at the
+// NIMs of all schools, so the sequence also works when NIMs are unique
+// across them.
+func (ds *Datastore) LastNIMSequence(prefix string) (int64, error) {
+	return withSchemaRetry(ds, func() (int64, error) {
+		return ds.lastNIMSequence(prefix)
+	})
+}
+
+func (ds *Datastore) lastNIMSequence(prefix string) (int64, error) {
+	start := utf8.RuneCountInString(prefix) + 1
+	var last int64
+	err := ds.conn().QueryRow(`SELECT COALESCE(MAX(CAST(substr(nim, ?) AS INTEGER)), 0) FROM students
+		WHERE substr(nim, 1, ?) = ? AND substr(nim, ?) <> '' AND substr(nim, ?) NOT GLOB '*[^0-9]*'`,
+		start, start-1, prefix, start, start).Scan(&last)
+	return last, err
+}
+
+type studentStats struct {
+	Count  int     `json:"count"`
+	MinAge uint16  `json:"min_age"`
+	MaxAge uint16  `json:"max_age"`
+	AvgAge float64 `json:"avg_age"`
+}
+
+// Stats aggregates the ages of all students. The ages are zero when there
+// are no students.
+func (ds *Datastore) Stats() (studentStats, error) {
+	return withSchemaRetry(ds, func() (studentStats, error) {
+		return ds.stats()
+	})
+}
+
+func (ds *Datastore) stats() (studentStats, error) {
+	var s studentStats
+	err := ds.conn().QueryRow("SELECT COUNT(*), COALESCE(MIN(age), 0), COALESCE(MAX(age), 0), COALESCE(AVG(age), 0) FROM students WHERE school_id = ?", ds.school).
+		Scan(&s.Count, &s.MinAge, &s.MaxAge, &s.AvgAge)
+	return s, err
+}
+
+type addressCount struct {
+	Address string `json:"address"`
+	Count   int    `json:"count"`
+}
+
+// AddressCounts returns how many students live at each address, most
+// populated first.
+func (ds *Datastore) AddressCounts() ([]addressCount, error) {
+	return withSchemaRetry(ds, func() ([]addressCount, error) {
+		return ds.addressCounts()
+	})
+}
+
+func (ds *Datastore) addressCounts() ([]addressCount, error) {
+	rows, err := ds.conn().Query("SELECT address, COUNT(*) FROM students WHERE school_id = ? GROUP BY address ORDER BY COUNT(*) DESC, address", ds.school)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []addressCount{}
+	for rows.Next() {
+		var c addressCount
+		if err := rows.Scan(&c.Address, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+type ageBucket struct {
+	Min   uint16 `json:"min"`
+	Max   uint16 `json:"max"`
+	Count int    `json:"count"`
+}
+
+// AgeDistribution counts students in consecutive buckets of size ages
+// covering r, empty buckets included. Ages outside r, which only legacy rows
+// can have, are counted in an extra bucket below or above r when there are
+// any.
+func (ds *Datastore) AgeDistribution(r ageRange, size uint16) ([]ageBucket, error) {
+	return withSchemaRetry(ds, func() ([]ageBucket, error) {
+		return ds.ageDistribution(r, size)
+	})
+}
+
+func (ds *Datastore) ageDistribution(r ageRange, size uint16) ([]ageBucket, error) {
+	var buckets []ageBucket
+	for lo := int(r.Min); lo <= int(r.Max); lo += int(size) {
+		hi := lo + int(size) - 1
+		if hi > int(r.Max) {
+			hi = int(r.Max)
+		}
+		buckets = append(buckets, ageBucket{Min: uint16(lo), Max: uint16(hi)})
+	}
+
+	rows, err := ds.conn().Query(`SELECT CASE
+			WHEN age < ? THEN -1
+			WHEN age > ? THEN -2
+			ELSE (age - ?) / ?
+		END AS bucket, COUNT(*)
+		FROM students WHERE school_id = ? GROUP BY bucket`, r.Min, r.Max, r.Min, size, ds.school)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var below, above int
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		switch {
+		case bucket == -1:
+			below = count
+		case bucket == -2:
+			above = count
+		case bucket < len(buckets):
+			buckets[bucket].Count = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if below > 0 {
+		buckets = append([]ageBucket{{Min: 0, Max: r.Min - 1, Count: below}}, buckets...)
+	}
+	if above > 0 {
+		buckets = append(buckets, ageBucket{Min: r.Max + 1, Max: math.MaxUint16, Count: above})
+	}
+	return buckets, nil
+}
+
+// SizeBytes returns the size of the database file as reported by SQLite.
+func (ds *Datastore) SizeBytes() (int64, error) {
+	var size int64
+	err := ds.conn().QueryRow("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	return size, err
+}
+
+// Vacuum rebuilds the database file to reclaim free pages. It cannot run
+// inside a transaction, so it always uses the connection pool.
+func (ds *Datastore) Vacuum() error {
+	_, err := ds.pool().Exec("VACUUM")
+	return err
+}
+
+// BackupTo writes a consistent snapshot of the database to path, which must
+// not exist yet. Like VACUUM it cannot run inside a transaction.
+func (ds *Datastore) BackupTo(path string) error {
+	_, err := ds.pool().Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// Analyze refreshes the statistics used by the query planner.
+func (ds *Datastore) Analyze() error {
+	_, err := ds.conn().Exec("ANALYZE")
+	return err
+}
+
+// isStorageUnavailable reports whether err means the database file cannot
+// be written at the moment: it turned read-only, the disk is full or failing.
+// Reads usually keep working in that state.
+func isStorageUnavailable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code {
+	case sqlite3.ErrReadonly, sqlite3.ErrIoErr, sqlite3.ErrFull:
+		return true
+	}
+	return false
+}
+
+func isConstraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// seedStudents stores n students with NIMs 000001 upwards.
+func seedStudents(t testing.TB, ds *Datastore, n int) {
+	t.Helper()
+
+	students := make([]Student, n)
+	for i := range students {
+		students[i] = Student{NIM: fmt.Sprintf("%06d", i+1), Name: "Student", Age: 20, Address: "Bandung"}
+	}
+	if err := ds.SaveBatch(students); err != nil {
+		t.Fatalf("seed %d students: %v", n, err)
+	}
+}
+
+// withoutWindowFunctions returns a copy of ds that counts with a second
+// query, as on SQLite builds without window functions.
+func withoutWindowFunctions(ds *Datastore) *Datastore {
+	two := *ds
+	two.windowFunctions = false
+	return &two
+}
+
+func TestFindAllTotal(t *testing.T) {
+	ds := newTestDatastore(t)
+	if !ds.windowFunctions {
+		t.Skip("SQLite build without window functions")
+	}
+	seedStudents(t, ds, 120)
+
+	tests := []struct {
+		name      string
+		q         listQuery
+		wantPage  int
+		wantTotal int
+	}{
+		{"first page", listQuery{Limit: 50}, 50, 120},
+		{"last page", listQuery{Limit: 50, Offset: 100}, 20, 120},
+		{"past the end", listQuery{Limit: 50, Offset: 500}, 0, 120},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := ds.FindAll(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			two, err := withoutWindowFunctions(ds).FindAll(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(window.Students) != tt.wantPage || window.Total != tt.wantTotal {
+				t.Errorf("got %d students of %d, want %d of %d", len(window.Students), window.Total, tt.wantPage, tt.wantTotal)
+			}
+			if !reflect.DeepEqual(window, two) {
+				t.Errorf("window count and two queries differ:\n%+v\n%+v", window, two)
+			}
+		})
+	}
+}
+
+func benchmarkList(b *testing.B, windowFunctions bool) {
+	ds := newTestDatastore(b)
+	if !ds.windowFunctions {
+		b.Skip("SQLite build without window functions")
+	}
+	seedStudents(b, ds, 10000)
+	if !windowFunctions {
+		ds = withoutWindowFunctions(ds)
+	}
+
+	q := listQuery{Limit: 50, Offset: 5000}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ds.FindAll(q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkListWindowCount(b *testing.B) { benchmarkList(b, true) }
+
+func BenchmarkListTwoQueries(b *testing.B) { benchmarkList(b, false) }
+
+// countStudents returns the number of students stored.
+func countStudents(t *testing.T, ds *Datastore) int {
+	t.Helper()
+
+	var n int
+	if err := ds.StudentSQLite.QueryRow("SELECT COUNT(*) FROM students").Scan(&n); err != nil {
+		t.Fatalf("count students: %v", err)
+	}
+	return n
+}
+
+// failCommitsOf makes the commit of any transaction that inserts a student
+// named name fail: the insert queues a row whose deferred foreign key is
+// only checked, and violated, at commit.
+func failCommitsOf(t *testing.T, ds *Datastore, name string) {
+	t.Helper()
+
+	for _, stmt := range []string{
+		`CREATE TABLE guardians (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE wards (nim TEXT, guardian INTEGER REFERENCES guardians(id) DEFERRABLE INITIALLY DEFERRED)`,
+		`CREATE TRIGGER orphan AFTER INSERT ON students WHEN NEW.name = '` + name + `' BEGIN INSERT INTO wards VALUES (NEW.nim, 42); END`,
+	} {
+		if _, err := ds.StudentSQLite.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+func TestSaveBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		students []Student
+		wantErr  string
+		stored   int
+	}{
+		{
+			name:     "all rows",
+			students: []Student{{NIM: "1", Name: "Ana", Age: 20, Address: "Bandung"}, {NIM: "2", Name: "Budi", Age: 21, Address: "Padang"}},
+			stored:   2,
+		},
+		{
+			name:     "insert fails",
+			students: []Student{{NIM: "1", Name: "Ana", Age: 20, Address: "Bandung"}, {NIM: "1", Name: "Budi", Age: 21, Address: "Padang"}},
+			wantErr:  "insert failed at row 1",
+		},
+		{
+			// Every insert succeeds, but the commit fails.
+			name:     "commit fails",
+			students: []Student{{NIM: "1", Name: "Ana", Age: 20, Address: "Bandung"}, {NIM: "2", Name: "Orphan", Age: 21, Address: "Padang"}},
+			wantErr:  errCommitFailed.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := newTestDatastore(t)
+			failCommitsOf(t, ds, "Orphan")
+
+			err := ds.SaveBatch(tt.students)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("SaveBatch: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("SaveBatch err = %v, want %q", err, tt.wantErr)
+			}
+			if tt.name == "commit fails" && !errors.Is(err, errCommitFailed) {
+				t.Errorf("err = %v, want it to wrap errCommitFailed", err)
+			}
+
+			if n := countStudents(t, ds); n != tt.stored {
+				t.Errorf("%d students stored, want %d", n, tt.stored)
+			}
+		})
+	}
+}
+
+// TestCreateStudentsCommitFailure checks that a batch whose request
+// transaction fails to commit is not answered as created.
+func TestCreateStudentsCommitFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		stored int
+	}{
+		{"committed", `[{"nim":"1","name":"Ana","age":20,"address":"Bandung"},{"nim":"2","name":"Budi","age":21,"address":"Padang"}]`, http.StatusCreated, 2},
+		{"commit fails", `[{"nim":"1","name":"Ana","age":20,"address":"Bandung"},{"nim":"2","name":"Orphan","age":21,"address":"Padang"}]`, http.StatusInternalServerError, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ds := newTestRouter(t)
+			failCommitsOf(t, ds, "Orphan")
+
+			rec := serve(h, http.MethodPost, "/students/batch", tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if n := countStudents(t, ds); n != tt.stored {
+				t.Errorf("%d students stored, want %d", n, tt.stored)
+			}
+		})
+	}
+}
+
+func TestBulkNIMsAcrossChunks(t *testing.T) {
+	const stored = 2500
+	ds := newTestDatastore(t)
+	seedStudents(t, ds, stored)
+
+	// Every stored NIM, a few unknown ones, and the first NIM again so that
+	// it lands in the last chunk as well as the first.
+	nims := make([]string, 0, stored+101)
+	for i := 1; i <= stored; i++ {
+		nims = append(nims, fmt.Sprintf("%06d", i))
+	}
+	for i := stored + 1; i <= stored+100; i++ {
+		nims = append(nims, fmt.Sprintf("%06d", i))
+	}
+	nims = append(nims, "000001")
+	if n := len(chunkNIMs(nims)); n < 3 {
+		t.Fatalf("%d NIMs split into %d chunks, want at least 3", len(nims), n)
+	}
+
+	students, err := ds.FindByNIMs(nims)
+	if err != nil {
+		t.Fatalf("FindByNIMs: %v", err)
+	}
+	if len(students) != stored {
+		t.Fatalf("found %d students, want %d", len(students), stored)
+	}
+	for i, student := range students {
+		if want := fmt.Sprintf("%06d", i+1); student.NIM != want {
+			t.Fatalf("student %d has NIM %s, want %s", i, student.NIM, want)
+		}
+	}
+
+	deleted, err := ds.DeleteByNIMs(nims[:2000])
+	if err != nil {
+		t.Fatalf("DeleteByNIMs: %v", err)
+	}
+	if deleted != 2000 {
+		t.Errorf("deleted %d students, want 2000", deleted)
+	}
+	if n := countStudents(t, ds); n != stored-2000 {
+		t.Errorf("%d students left, want %d", n, stored-2000)
+	}
+}
+
+// benchmarkFilteredList lists one page of students filtered by age and
+// address out of a larger table, with or without the filter indexes.
+func benchmarkFilteredList(b *testing.B, indexed bool) {
+	ds := newTestDatastore(b)
+
+	addresses := []string{"Bandung", "Jakarta", "Medan", "Padang", "Surabaya", "Yogyakarta", "Makassar", "Malang"}
+	students := make([]Student, 50000)
+	for i := range students {
+		students[i] = Student{
+			NIM:     fmt.Sprintf("%06d", i+1),
+			Name:    "Student",
+			Age:     uint16(17 + i%50),
+			Address: addresses[i%len(addresses)],
+		}
+	}
+	if err := ds.SaveBatch(students); err != nil {
+		b.Fatalf("seed: %v", err)
+	}
+	if !indexed {
+		for _, index := range []string{"students_school_age", "students_school_address", "students_school_nim"} {
+			if _, err := ds.StudentSQLite.Exec("DROP INDEX " + index); err != nil {
+				b.Fatalf("drop %s: %v", index, err)
+			}
+		}
+	}
+
+	q := listQuery{Limit: 50, Filter: studentFilter{MinAge: 30, MaxAge: 31, Addresses: []string{"Medan"}}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ds.FindAll(q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFilteredListIndexed(b *testing.B) { benchmarkFilteredList(b, true) }
+
+func BenchmarkFilteredListUnindexed(b *testing.B) { benchmarkFilteredList(b, false) }
+
+func TestNewDatastoreUnopenable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "students.db")
+
+	_, err := newDatastore(path, nimScopeGlobal)
+	if err == nil {
+		t.Fatal("opened a database in a directory that does not exist")
+	}
+	for _, want := range []string{path, sqliteDriver} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not name %s", err, want)
+		}
+	}
+}
+
+func TestUpdateByNIMPrepareFailure(t *testing.T) {
+	ds := newTestDatastore(t)
+	student := Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"}
+	addStudents(t, ds, student)
+
+	// Prepare fails on a transaction that has already been rolled back.
+	tx, err := ds.StudentSQLite.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	tx.Rollback()
+	if _, err := ds.WithTx(tx).UpdateByNIM(student); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("update in a finished transaction: %v, want %v", err, sql.ErrTxDone)
+	}
+
+	ds.StudentSQLite.Close()
+	if _, err := ds.UpdateByNIM(student); err == nil {
+		t.Error("update on a closed database succeeded")
+	}
+}
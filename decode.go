@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var errEmptyBody = errors.New("request body must not be empty")
+var errTrailingData = errors.New("request body must contain a single JSON value")
+
+// decodeStudent is the single decode path shared by the POST and PUT
+// handlers. Every error it returns is a client error and maps to 400. With
+// rejectDuplicates a key repeated within an object is an error instead of
+// the last value silently winning.
+func decodeStudent(body io.Reader, rejectDuplicates bool) (Student, error) {
+	body, err := checkDuplicates(body, rejectDuplicates)
+	if err != nil {
+		return Student{}, err
+	}
+
+	var student Student
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&student); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Student{}, errEmptyBody
+		}
+		return Student{}, err
+	}
+
+	if dec.More() {
+		return Student{}, errTrailingData
+	}
+
+	return student, nil
+}
+
+// decodeStudents decodes the JSON array sent to the batch endpoints.
+func decodeStudents(body io.Reader, rejectDuplicates bool) ([]Student, error) {
+	body, err := checkDuplicates(body, rejectDuplicates)
+	if err != nil {
+		return nil, err
+	}
+
+	var students []Student
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&students); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errEmptyBody
+		}
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, errTrailingData
+	}
+
+	return students, nil
+}
+
+// decodeNIMs decodes the JSON array of NIMs sent to the bulk lookup and
+// delete endpoints.
+func decodeNIMs(body io.Reader) ([]string, error) {
+	var nims []string
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&nims); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errEmptyBody
+		}
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, errTrailingData
+	}
+
+	return nims, nil
+}
+
+// renameRequest is the body of POST /students/{nim}/rename.
+type renameRequest struct {
+	NewNIM string `json:"new_nim"`
+}
+
+// decodeRename decodes the body of a rename. Like decodeStudent, every error
+// it returns maps to 400.
+func decodeRename(body io.Reader, rejectDuplicates bool) (renameRequest, error) {
+	body, err := checkDuplicates(body, rejectDuplicates)
+	if err != nil {
+		return renameRequest{}, err
+	}
+
+	var req renameRequest
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			return renameRequest{}, errEmptyBody
+		}
+		return renameRequest{}, err
+	}
+
+	if dec.More() {
+		return renameRequest{}, errTrailingData
+	}
+
+	return req, nil
+}
+
+// flexUint16 decodes from a JSON number or from a string holding one, as
+// sent by form serializers that stringify every value.
+type flexUint16 uint16
+
+func (n *flexUint16) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+		if err != nil {
+			return &json.UnmarshalTypeError{Value: "string " + strconv.Quote(s), Type: reflect.TypeOf(uint16(0))}
+		}
+		*n = flexUint16(v)
+		return nil
+	}
+
+	var v uint16
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*n = flexUint16(v)
+	return nil
+}
+
+// UnmarshalJSON decodes a student, accepting the age as a number or a
+// numeric string.
+func (s *Student) UnmarshalJSON(b []byte) error {
+	type plain Student
+	aux := struct {
+		*plain
+		Age flexUint16 `json:"age"`
+	}{plain: (*plain)(s), Age: flexUint16(s.Age)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		// Errors from flexUint16 come without the field the encoding/json
+		// decoder adds to its own; restore it for describeDecodeError.
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field == "" && typeErr.Type.Kind() == reflect.Uint16 {
+			typeErr.Field = "age"
+		}
+		return err
+	}
+	s.Age = uint16(aux.Age)
+	return nil
+}
+
+// duplicateFieldError reports a key that appears twice in one object.
+type duplicateFieldError struct {
+	Field string
+}
+
+func (e *duplicateFieldError) Error() string {
+	return "duplicate field: " + e.Field
+}
+
+// checkDuplicates buffers body and scans it for duplicate keys when enabled,
+// returning a reader over the same bytes for the actual decode. Syntax
+// errors are left for the decoder to report.
+func checkDuplicates(body io.Reader, enabled bool) (io.Reader, error) {
+	if !enabled {
+		return body, nil
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := findDuplicateKey(json.NewDecoder(bytes.NewReader(b))); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// findDuplicateKey walks the tokens of the first JSON value in dec and
+// returns a duplicateFieldError for the first key repeated in an object.
+func findDuplicateKey(dec *json.Decoder) error {
+	type frame struct {
+		object    bool
+		expectKey bool
+		keys      map[string]bool
+	}
+	var stack []*frame
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+
+		if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+			top := stack[n-1]
+			if key, ok := tok.(string); ok {
+				if top.keys[key] {
+					return &duplicateFieldError{Field: key}
+				}
+				top.keys[key] = true
+				top.expectKey = false
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &frame{object: true, expectKey: true, keys: map[string]bool{}})
+			continue
+		case json.Delim('['):
+			stack = append(stack, &frame{})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+
+		if len(stack) == 0 {
+			return nil
+		}
+		if top := stack[len(stack)-1]; top.object {
+			top.expectKey = true
+		}
+	}
+}
+
+// decodeErrorStatus maps a decode error to its status: 413 for a body that
+// inflates past MAX_DECOMPRESSED_BODY_BYTES, 400 for anything else.
+func decodeErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// describeDecodeError turns a decode error into a message that tells
+// the client which field or byte offset is at fault.
+func describeDecodeError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		return fmt.Sprintf("request body exceeds maximum of %d bytes", tooLarge.Limit)
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed JSON at byte offset %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "malformed JSON: unexpected end of input"
+	case errors.As(err, &typeErr):
+		expected := jsonTypeName(typeErr.Type)
+		if typeErr.Field == "" {
+			return fmt.Sprintf("invalid JSON: expected %s, got %s", expected, typeErr.Value)
+		}
+		if expected == "number" && strings.HasPrefix(typeErr.Value, "number") {
+			return fmt.Sprintf("invalid value for field '%s': number out of range", typeErr.Field)
+		}
+		return fmt.Sprintf("invalid value for field '%s': expected %s", typeErr.Field, expected)
+	default:
+		return err.Error()
+	}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// FuzzDecodeStudent sends arbitrary bodies to the endpoints that decode a
+// single student. They must never panic, and a body decodeStudent rejects
+// must be answered with a 4xx.
+func FuzzDecodeStudent(f *testing.F) {
+	seeds := []string{
+		``,
+		` `,
+		`null`,
+		`{}`,
+		`[]`,
+		`{"nim":"1301","name":"Ana","age":20,"address":"Bandung"}`,
+		`{"nim":"1301","name":"Ana","age":20,"address":"Bandung"} {}`,
+		`{"nim":"1301","nim":"1302"}`,
+		`{"age":70000}`,
+		`{"age":-1}`,
+		`{"age":1e400}`,
+		`{"name":"\ud800"}`,
+		`{"nim":`,
+		`{"nim":1301}`,
+		"\xef\xbb\xbf{}",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	h, _ := newTestRouter(f)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		_, decodeErr := decodeStudent(bytes.NewReader(body), defaultConfig().RejectDuplicateFields)
+
+		for _, method := range []string{http.MethodPost, http.MethodPut} {
+			rec := serve(h, method, "/students", string(body))
+			if decodeErr != nil && (rec.Code < 400 || rec.Code >= 500) {
+				t.Fatalf("%s /students with %q rejected by the decoder (%v): status %d, want 4xx", method, body, decodeErr, rec.Code)
+			}
+		}
+	})
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty body", ``, `request body must not be empty`},
+		{"syntax error", `{"nim":"1301",}`, `malformed JSON at byte offset 15`},
+		{"truncated", `{"nim":`, `malformed JSON: unexpected end of input`},
+		{"wrong type", `{"name":1}`, `invalid value for field 'name': expected string`},
+		{"out of range", `{"age":70000}`, `invalid value for field 'age': number out of range`},
+		{"negative age", `{"age":-1}`, `invalid value for field 'age': number out of range`},
+		{"trailing data", `{"nim":"1301"} {}`, `request body must contain a single JSON value`},
+	}
+
+	h, _ := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, method := range []string{http.MethodPost, http.MethodPut} {
+				rec := serve(h, method, "/students", tt.body)
+				if rec.Code != http.StatusBadRequest {
+					t.Fatalf("%s: status %d, want 400", method, rec.Code)
+				}
+				var got errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatalf("%s: decode response %q: %v", method, rec.Body, err)
+				}
+				if got.Error != tt.want {
+					t.Errorf("%s: error %q, want %q", method, got.Error, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		reject     bool
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"repeated nim", true, http.MethodPost, "/students", `{"nim":"1301","nim":"1302","name":"Ana","age":20,"address":"Bandung"}`, http.StatusBadRequest, "duplicate field: nim"},
+		{"repeated in update", true, http.MethodPut, "/students", `{"nim":"1301","name":"Ana","name":"Budi","age":20,"address":"Bandung"}`, http.StatusBadRequest, "duplicate field: name"},
+		{"repeated in batch item", true, http.MethodPost, "/students/batch", `[` + studentJSON("1303") + `,{"nim":"1304","age":20,"age":21}]`, http.StatusBadRequest, "duplicate field: age"},
+		{"same key in two objects", true, http.MethodPost, "/students/batch", `[` + studentJSON("1305") + `,` + studentJSON("1306") + `]`, http.StatusCreated, ""},
+		{"check turned off", false, http.MethodPost, "/students", `{"nim":"1301","nim":"1302","name":"Ana","age":20,"address":"Bandung"}`, http.StatusCreated, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RejectDuplicateFields = tt.reject
+			h, ds := newTestRouter(t, WithConfig(cfg))
+
+			rec := serve(h, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError != "" {
+				var got errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Error != tt.wantError {
+					t.Errorf("body %s, want error %q", rec.Body, tt.wantError)
+				}
+			}
+			if !tt.reject {
+				// Without the check the last value wins, as in encoding/json.
+				if _, err := ds.FindByNIM("1302"); err != nil {
+					t.Errorf("find 1302: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAgeAsString(t *testing.T) {
+	tests := []struct {
+		name       string
+		age        string
+		wantStatus int
+		wantAge    uint16
+		wantError  string
+	}{
+		{"number", `20`, http.StatusCreated, 20, ""},
+		{"string", `"21"`, http.StatusCreated, 21, ""},
+		{"string with spaces", `" 22 "`, http.StatusCreated, 22, ""},
+		{"string that is not a number", `"twenty"`, http.StatusBadRequest, 0, "invalid value for field 'age': expected number"},
+		{"empty string", `""`, http.StatusBadRequest, 0, "invalid value for field 'age': expected number"},
+		{"negative string", `"-1"`, http.StatusBadRequest, 0, "invalid value for field 'age': expected number"},
+		{"string out of range", `"70000"`, http.StatusBadRequest, 0, "invalid value for field 'age': expected number"},
+		{"fraction", `20.5`, http.StatusBadRequest, 0, "invalid value for field 'age': number out of range"},
+		{"boolean", `true`, http.StatusBadRequest, 0, "invalid value for field 'age': expected number"},
+	}
+
+	h, _ := newTestRouter(t)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nim := fmt.Sprintf("14%02d", i)
+			body := `{"nim":"` + nim + `","name":"Ana","age":` + tt.age + `,"address":"Bandung"}`
+			rec := serve(h, http.MethodPost, "/students", body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError != "" {
+				var got errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Error != tt.wantError {
+					t.Errorf("body %s, want error %q", rec.Body, tt.wantError)
+				}
+				return
+			}
+
+			rec = serve(h, http.MethodGet, "/students/"+nim, "")
+			var got map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if age, ok := got["age"].(float64); !ok || age != float64(tt.wantAge) {
+				t.Errorf("age %#v, want the number %d", got["age"], tt.wantAge)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// dedupeWindow remembers recent write requests by a hash of the client,
+// school, path and body, to turn away double submits.
+type dedupeWindow struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[[sha256.Size]byte]time.Time
+	lastSweep time.Time
+}
+
+func newDedupeWindow(window time.Duration) *dedupeWindow {
+	return &dedupeWindow{window: window, seen: map[[sha256.Size]byte]time.Time{}}
+}
+
+// Middleware answers a POST with 409 when an identical one from the same
+// client arrived less than the window ago and either is still running or
+// succeeded. A request that fails does not count, so it can be retried
+// right away. A zero window turns deduplication off.
+func (d *dedupeWindow) Middleware(next http.Handler) http.Handler {
+	if d.window <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The port differs between connections of the same client.
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+
+		h := sha256.New()
+		for _, part := range []string{client, r.Header.Get(schoolHeader), r.URL.Path} {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+		h.Write(body)
+		var key [sha256.Size]byte
+		copy(key[:], h.Sum(nil))
+
+		if !d.claim(key) {
+			respondError(w, r, http.StatusConflict, "an identical request was just made, not repeating it")
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if status := ww.Status(); status != 0 && (status < 200 || status >= 300) {
+			d.release(key)
+		}
+	})
+}
+
+// claim records key and reports whether it was free.
+func (d *dedupeWindow) claim(key [sha256.Size]byte) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.lastSweep) > d.window {
+		for k, t := range d.seen {
+			if now.Sub(t) > d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	if t, ok := d.seen[key]; ok && now.Sub(t) <= d.window {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+func (d *dedupeWindow) release(key [sha256.Size]byte) {
+	d.mu.Lock()
+	delete(d.seen, key)
+	d.mu.Unlock()
+}
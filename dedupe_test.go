@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dedupeRequest is a POST to the dedupe middleware from remoteAddr.
+func dedupeRequest(h http.Handler, remoteAddr, school, body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/students", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if school != "" {
+		req.Header.Set(schoolHeader, school)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestDedupeWindow(t *testing.T) {
+	const first = `{"nim":"1301"}`
+	tests := []struct {
+		name string
+		// remoteAddr, school and body describe the second request.
+		remoteAddr string
+		school     string
+		body       string
+		// firstStatus is what the handler answers the first request with.
+		firstStatus int
+		wait        time.Duration
+		wantRun     bool
+	}{
+		{"identical", "192.0.2.1:1234", "", first, http.StatusCreated, 0, false},
+		{"same client, other port", "192.0.2.1:5678", "", first, http.StatusCreated, 0, false},
+		{"other body", "192.0.2.1:1234", "", `{"nim":"1302"}`, http.StatusCreated, 0, true},
+		{"other client", "192.0.2.2:1234", "", first, http.StatusCreated, 0, true},
+		{"other school", "192.0.2.1:1234", "school-b", first, http.StatusCreated, 0, true},
+		{"first failed", "192.0.2.1:1234", "", first, http.StatusInternalServerError, 0, true},
+		{"first rejected", "192.0.2.1:1234", "", first, http.StatusUnprocessableEntity, 0, true},
+		{"after the window", "192.0.2.1:1234", "", first, http.StatusCreated, 80 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := 0
+			status := tt.firstStatus
+			h := newDedupeWindow(50 * time.Millisecond).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				runs++
+				w.WriteHeader(status)
+			}))
+
+			if got := dedupeRequest(h, "192.0.2.1:1234", "", first); got != tt.firstStatus {
+				t.Fatalf("first request: status %d, want %d", got, tt.firstStatus)
+			}
+			time.Sleep(tt.wait)
+			status = http.StatusCreated
+			got := dedupeRequest(h, tt.remoteAddr, tt.school, tt.body)
+
+			if ran := runs == 2; ran != tt.wantRun {
+				t.Fatalf("second request ran %v, want %v", ran, tt.wantRun)
+			}
+			if !tt.wantRun && got != http.StatusConflict {
+				t.Errorf("duplicate: status %d, want %d", got, http.StatusConflict)
+			}
+		})
+	}
+}
+
+func TestDedupeWindowDisabled(t *testing.T) {
+	runs := 0
+	h := newDedupeWindow(0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for i := 0; i < 3; i++ {
+		dedupeRequest(h, "192.0.2.1:1234", "", `{"nim":"1301"}`)
+	}
+	if runs != 3 {
+		t.Errorf("ran %d of 3 identical requests with deduplication off", runs)
+	}
+}
+
+func TestDedupeRoutes(t *testing.T) {
+	cfg := testConfig()
+	cfg.DedupeWindow = time.Minute
+	h, ds := newTestRouter(t, WithConfig(cfg))
+
+	for _, tt := range []struct {
+		target string
+		body   string
+	}{
+		{"/students", studentJSON("1301")},
+		{"/students/batch", batchJSON("1302", "1303")},
+	} {
+		if rec := serve(h, http.MethodPost, tt.target, tt.body); rec.Code != http.StatusCreated {
+			t.Fatalf("POST %s: status %d: %s", tt.target, rec.Code, rec.Body)
+		}
+		rec := serve(h, http.MethodPost, tt.target, tt.body)
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "identical request") {
+			t.Errorf("repeated POST %s: status %d: %s, want the dedupe 409", tt.target, rec.Code, rec.Body)
+		}
+	}
+	if n := countStudents(t, ds); n != 3 {
+		t.Errorf("%d students stored, want 3", n)
+	}
+}
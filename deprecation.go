@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// deprecate marks responses from the routes in patterns as deprecated with
+// the Deprecation header and, when sunset is set, announces when they go
+// away with the Sunset header (RFC 8594). "*" flags every route the
+// middleware is mounted on. It must run inside a group so the route pattern
+// is known by the time it runs.
+func deprecate(patterns []string, sunset time.Time) func(next http.Handler) http.Handler {
+	flagged := make(map[string]bool, len(patterns))
+	for _, p := range patterns {
+		flagged[p] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(flagged) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rctx := chi.RouteContext(r.Context()); rctx != nil &&
+				(flagged["*"] || flagged[rctx.RoutePattern()]) {
+				w.Header().Set("Deprecation", "true")
+				if !sunset.IsZero() {
+					w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// paramAliases maps the old names of renamed query parameters to their
+// current ones.
+var paramAliases = map[string]string{
+	"search": "q",
+}
+
+// aliasParams renames the query parameters in aliases before the handlers
+// read them, so clients still sending an old name keep working. Each old
+// name used adds a Warning header naming its replacement. When both names
+// are sent, the current one wins.
+func aliasParams(aliases map[string]string) func(next http.Handler) http.Handler {
+	old := make([]string, 0, len(aliases))
+	for name := range aliases {
+		old = append(old, name)
+	}
+	sort.Strings(old)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			renamed := false
+			for _, name := range old {
+				values, ok := q[name]
+				if !ok {
+					continue
+				}
+				current := aliases[name]
+				if _, ok := q[current]; !ok {
+					q[current] = values
+				}
+				q.Del(name)
+				renamed = true
+				w.Header().Add("Warning", fmt.Sprintf(`299 - "query parameter %s is deprecated, use %s"`, name, current))
+			}
+			if renamed {
+				r.URL.RawQuery = q.Encode()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
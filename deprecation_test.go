@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParamAliases(t *testing.T) {
+	const warning = `299 - "query parameter search is deprecated, use q"`
+	tests := []struct {
+		name        string
+		query       string
+		want        []string
+		wantWarning []string
+	}{
+		{"current name", "?q=ana", []string{"1301"}, nil},
+		{"old name", "?search=ana", []string{"1301"}, []string{warning}},
+		{"current name wins", "?search=ana&q=budi", []string{"1302"}, []string{warning}},
+		{"with other filters", "?search=a&max_age=20", []string{"1301"}, []string{warning}},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds,
+		Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"},
+		Student{NIM: "1302", Name: "Budi", Age: 21, Address: "Padang"},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if got := listNIMs(t, rec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+			if got := rec.Header().Values("Warning"); !reflect.DeepEqual(got, tt.wantWarning) {
+				t.Errorf("Warning %q, want %q", got, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestParamAliasesRewrite(t *testing.T) {
+	var got string
+	h := aliasParams(map[string]string{"old": "new", "older": "new"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.RawQuery
+	}))
+
+	rec := serve(h, http.MethodGet, "/?old=1&older=2&other=3", "")
+	if got != "new=1&other=3" {
+		t.Errorf("query %q, want new=1&other=3", got)
+	}
+	if n := len(rec.Header().Values("Warning")); n != 2 {
+		t.Errorf("%d warnings, want one per old name", n)
+	}
+}
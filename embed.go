@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const embedCohortSize = "cohort_size"
+
+// embeddable lists what ?embed= may ask GET /students/{nim} to add to the
+// student. Each costs an extra query, so none is computed unless asked for.
+var embeddable = []string{embedCohortSize}
+
+// parseEmbed reads the comma separated ?embed= list.
+func parseEmbed(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("embed")
+	if v == "" {
+		return nil, nil
+	}
+
+	var embeds []string
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if !containsString(embeddable, name) {
+			return nil, fmt.Errorf("cannot embed %q, expected one of %s", name, strings.Join(embeddable, ", "))
+		}
+		if !containsString(embeds, name) {
+			embeds = append(embeds, name)
+		}
+	}
+	return embeds, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// embed computes the requested embeds for student.
+func (h *handler) embed(ds *Datastore, student Student, embeds []string) (map[string]any, error) {
+	embedded := make(map[string]any, len(embeds))
+	for _, name := range embeds {
+		switch name {
+		case embedCohortSize:
+			n, err := h.cohortSize(ds, student.NIM)
+			if err != nil {
+				return nil, err
+			}
+			embedded[name] = n
+		}
+	}
+	return embedded, nil
+}
+
+// cohortSize counts the other students of the school whose NIM shares the
+// first CohortPrefixLength characters of nim, which encode the cohort.
+func (h *handler) cohortSize(ds *Datastore, nim string) (int, error) {
+	prefix := nim
+	if runes := []rune(nim); len(runes) > h.cfg.CohortPrefixLength {
+		prefix = string(runes[:h.cfg.CohortPrefixLength])
+	}
+
+	n, err := ds.Count(studentFilter{NIMPrefix: prefix})
+	if err != nil {
+		return 0, err
+	}
+	// The student itself is part of its cohort.
+	if n > 0 {
+		n--
+	}
+	return n, nil
+}
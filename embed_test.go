@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestEmbedCohortSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefixLength int
+		target       string
+		wantStatus   int
+		// want is the embedded cohort size, or -1 when nothing may be
+		// embedded.
+		want int
+	}{
+		{"not asked", 4, "/students/2021001", http.StatusOK, -1},
+		{"cohort", 4, "/students/2021001?embed=cohort_size", http.StatusOK, 2},
+		{"alone in cohort", 4, "/students/2022001?embed=cohort_size", http.StatusOK, 0},
+		{"repeated", 4, "/students/2021001?embed=cohort_size,%20cohort_size", http.StatusOK, 2},
+		{"longer prefix", 6, "/students/2021001?embed=cohort_size", http.StatusOK, 1},
+		{"unknown embed", 4, "/students/2021001?embed=guardians", http.StatusBadRequest, -1},
+		{"unknown student", 4, "/students/2029999?embed=cohort_size", http.StatusNotFound, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CohortPrefixLength = tt.prefixLength
+			h, ds := newTestRouter(t, WithConfig(cfg))
+			addStudents(t, ds,
+				Student{NIM: "2021001", Name: "Ana", Age: 20, Address: "Bandung"},
+				Student{NIM: "2021002", Name: "Budi", Age: 20, Address: "Bandung"},
+				Student{NIM: "2021013", Name: "Citra", Age: 20, Address: "Bandung"},
+				Student{NIM: "2022001", Name: "Dewi", Age: 20, Address: "Bandung"},
+			)
+			// Another school's students are not part of the cohort.
+			addStudents(t, ds.ForSchool("school-b"), Student{NIM: "2021009", Name: "Fajar", Age: 20, Address: "Bandung"})
+
+			rec := serve(h, http.MethodGet, tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Embedded map[string]int `json:"embedded"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if tt.want < 0 {
+				if resp.Embedded != nil {
+					t.Errorf("embedded %v without ?embed", resp.Embedded)
+				}
+				return
+			}
+			if got, ok := resp.Embedded[embedCohortSize]; !ok || got != tt.want {
+				t.Errorf("cohort size %d (present %v), want %d", got, ok, tt.want)
+			}
+		})
+	}
+}
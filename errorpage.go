@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+const htmlMediaType = "text/html"
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+<p>{{.Message}}</p>
+<p>The student API is served under <a href="/api/v1/students">/api/v1</a>.</p>
+</body>
+</html>
+`))
+
+// respondRoutingError answers a request no route serves. People poking at
+// the API in a browser get a small HTML page; everyone else, including
+// clients without an Accept header, gets the usual JSON error.
+func respondRoutingError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if negotiate(r, "application/json", htmlMediaType) != htmlMediaType {
+		respondError(w, r, status, message)
+		return
+	}
+
+	w.Header().Set("Content-Type", htmlMediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	errorPage.Execute(w, struct {
+		Status  int
+		Title   string
+		Message string
+	}{status, http.StatusText(status), message})
+}
+
+func routeNotFound(w http.ResponseWriter, r *http.Request) {
+	respondRoutingError(w, r, http.StatusNotFound, fmt.Sprintf("no route matches %s", r.URL.Path))
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	respondRoutingError(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", r.Method, r.URL.Path))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRoutingErrors(t *testing.T) {
+	const browser = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	tests := []struct {
+		name            string
+		method          string
+		target          string
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{"404 as JSON", http.MethodGet, "/nope", "application/json", http.StatusNotFound, "application/json", `"error":"no route matches /nope"`},
+		{"404 as HTML", http.MethodGet, "/nope", browser, http.StatusNotFound, "text/html", "<h1>404 Not Found</h1>"},
+		{"404 without Accept", http.MethodGet, "/nope", "", http.StatusNotFound, "application/json", `"error":"no route matches /nope"`},
+		{"404 as JSON:API", http.MethodGet, "/nope", jsonAPIMediaType, http.StatusNotFound, jsonAPIMediaType, `"errors"`},
+		{"405 as JSON", http.MethodPatch, "/students", "application/json", http.StatusMethodNotAllowed, "application/json", `"error":"PATCH is not allowed on /students"`},
+		{"405 as HTML", http.MethodPatch, "/students", browser, http.StatusMethodNotAllowed, "text/html", "<h1>405 Method Not Allowed</h1>"},
+		{"path escaped in HTML", http.MethodGet, "/%3Cscript%3E", browser, http.StatusNotFound, "text/html", "no route matches /&lt;script&gt;"},
+	}
+
+	h, _ := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header []string
+			if tt.accept != "" {
+				header = []string{"Accept", tt.accept}
+			}
+			rec := serve(h, tt.method, tt.target, "", header...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantContentType) {
+				t.Errorf("Content-Type %q, want %s", got, tt.wantContentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %s, want it to contain %s", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errPreconditionFailed = errors.New("resource has been modified")
+var errPreconditionRequired = errors.New("If-Match header is required")
+
+// studentETag returns a strong ETag derived from the student's JSON form.
+func studentETag(student Student) string {
+	b, _ := json.Marshal(student)
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-Match header value matches etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces the If-Match precondition against the current state
+// of the student identified by nim. It writes the error response and returns
+// false when the request must not proceed.
+func (h *handler) checkIfMatch(w http.ResponseWriter, r *http.Request, nim string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if h.cfg.RequireIfMatch {
+			respondError(w, r, http.StatusPreconditionRequired, errPreconditionRequired.Error())
+			return false
+		}
+		return true
+	}
+
+	current, err := h.store(r).FindByNIM(nim)
+	if err != nil && !errors.Is(err, errDataNotFound) {
+		respondDatastoreError(w, r, err)
+		return false
+	}
+
+	if err != nil || !etagMatches(header, studentETag(current)) {
+		respondError(w, r, http.StatusPreconditionFailed, errPreconditionFailed.Error())
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConditionalDelete(t *testing.T) {
+	tests := []struct {
+		name string
+		// ifMatch is the If-Match header; "current" stands for the ETag the
+		// student has when the test starts.
+		ifMatch     string
+		require     bool
+		changeFirst bool
+		wantStatus  int
+	}{
+		{"matching", "current", false, false, http.StatusOK},
+		{"matching among several", `"other", current`, false, false, http.StatusOK},
+		{"wildcard", "*", false, false, http.StatusOK},
+		{"mismatching", `"0123456789abcdef"`, false, false, http.StatusPreconditionFailed},
+		{"changed since read", "current", false, true, http.StatusPreconditionFailed},
+		{"without header", "", false, false, http.StatusOK},
+		{"without header when required", "", true, false, http.StatusPreconditionRequired},
+		{"matching when required", "current", true, false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RequireIfMatch = tt.require
+			h, ds := newTestRouter(t, WithConfig(cfg))
+			addStudents(t, ds, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+
+			etag := serve(h, http.MethodGet, "/students/1301", "").Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("GET sent no ETag")
+			}
+			if tt.changeFirst {
+				if _, err := ds.UpdateField("1301", "age", uint16(21)); err != nil {
+					t.Fatalf("change student: %v", err)
+				}
+			}
+
+			var header []string
+			if tt.ifMatch != "" {
+				header = []string{"If-Match", strings.ReplaceAll(tt.ifMatch, "current", etag)}
+			}
+			rec := serve(h, http.MethodDelete, "/students/1301", "", header...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			_, err := ds.FindByNIM("1301")
+			if deleted := errors.Is(err, errDataNotFound); deleted != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("deleted %v after status %d", deleted, rec.Code)
+			}
+		})
+	}
+}
+
+func TestConditionalDeleteUnknown(t *testing.T) {
+	h, _ := newTestRouter(t)
+
+	rec := serve(h, http.MethodDelete, "/students/1399", "", "If-Match", `"0123456789abcdef"`)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportFlushRows is how many rows are buffered before they are flushed to
+// the client.
+const exportFlushRows = 500
+
+var studentExportColumns = append(studentCSVColumns, "created_at", "updated_at")
+
+// exportCSV streams the students matching the listing filters as CSV. The
+// header row uses the column names the import expects, so an export can be
+// imported again. Rows are written as they are read; once the first byte is
+// out, a failure can only be logged. With ?bom=true the file starts with a
+// UTF-8 byte order mark, without which Excel reads names such as Zoë in the
+// local code page.
+func (h *handler) exportCSV(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	bom, err := parseFlag(r, "bom")
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("students-%s.csv", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	if bom {
+		io.WriteString(w, utf8BOM)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(studentExportColumns)
+
+	rows := 0
+	err = h.store(r).EachStudent(filter, func(s Student) error {
+		// A client that went away stops the scan instead of letting it
+		// run to the end for nobody.
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		cw.Write([]string{
+			s.NIM,
+			s.Name,
+			strconv.Itoa(int(s.Age)),
+			s.Address,
+			formatStoredTimestamp(s.CreatedAt),
+			formatStoredTimestamp(s.UpdatedAt),
+		})
+		rows++
+		if rows%exportFlushRows == 0 {
+			cw.Flush()
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		return cw.Error()
+	})
+	if isContextError(err) {
+		log.Printf("export: client went away after %d rows, stopped", rows)
+		return
+	}
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		log.Printf("export: after %d rows: %v", rows, err)
+	}
+}
+
+// exportJSON streams every student of the school as one JSON array, for
+// backups that outlive the SQLite format. Students are encoded one at a time
+// so memory stays flat however many there are; ?pretty indents them.
+func (h *handler) exportJSON(w http.ResponseWriter, r *http.Request) {
+	pretty, err := parseFlag(r, "pretty")
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("students-%s.json", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// indent starts every student on its own line when pretty.
+	indent := ""
+	if pretty {
+		enc.SetIndent("  ", "  ")
+		indent = "\n  "
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	rows := 0
+	err = h.store(r).EachStudent(studentFilter{}, func(s Student) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+		if rows > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString(indent)
+		// Encode ends every student with a newline, left out so the array
+		// can be laid out as a whole.
+		bw.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		return nil
+	})
+	if isContextError(err) {
+		log.Printf("export: client went away after %d rows, stopped", rows)
+		return
+	}
+	if err != nil {
+		// The array is left unterminated, so the client cannot mistake
+		// the truncated download for a complete one.
+		bw.Flush()
+		log.Printf("export: after %d rows: %v", rows, err)
+		return
+	}
+	if pretty && rows > 0 {
+		bw.WriteString("\n")
+	}
+	bw.WriteString("]\n")
+	if err := bw.Flush(); err != nil {
+		log.Printf("export: after %d rows: %v", rows, err)
+	}
+}
+
+// parseFlag reads the boolean query parameter param, which on its own
+// means true.
+func parseFlag(r *http.Request, param string) (bool, error) {
+	v, ok := r.URL.Query()[param]
+	if !ok {
+		return false, nil
+	}
+	if v[0] == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(v[0])
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", param)
+	}
+	return b, nil
+}
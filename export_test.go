@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportNIMs returns the NIM column of a CSV export and checks its header.
+func exportNIMs(t *testing.T, body string) []string {
+	t.Helper()
+
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if len(records) == 0 || !reflect.DeepEqual(records[0], studentExportColumns) {
+		t.Fatalf("export header %v, want %v", records, studentExportColumns)
+	}
+
+	nims := []string{}
+	for _, rec := range records[1:] {
+		nims = append(nims, rec[0])
+	}
+	return nims
+}
+
+func TestExportCSVFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{"everyone", "", http.StatusOK, []string{"1301", "1302", "1303", "1304"}},
+		{"name", "?name=AN", http.StatusOK, []string{"1301", "1303"}},
+		{"age range", "?min_age=21&max_age=30", http.StatusOK, []string{"1302", "1303"}},
+		{"name and age", "?name=an&min_age=21", http.StatusOK, []string{"1303"}},
+		{"no match", "?name=zz", http.StatusOK, []string{}},
+		{"invalid range", "?min_age=30&max_age=20", http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	err := ds.SaveBatch([]Student{
+		{NIM: "1301", Name: "Ana", Age: 19, Address: "Bandung"},
+		{NIM: "1302", Name: "Budi", Age: 22, Address: "Jakarta"},
+		{NIM: "1303", Name: "Joana", Age: 30, Address: "Bandung"},
+		{NIM: "1304", Name: "Citra", Age: 45, Address: "Medan"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students.csv"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := exportNIMs(t, rec.Body.String()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		key        string
+		students   int
+		wantStatus int
+		wantPretty bool
+	}{
+		{"compact", "", "secret", 3, http.StatusOK, false},
+		{"pretty", "?pretty", "secret", 3, http.StatusOK, true},
+		{"pretty false", "?pretty=false", "secret", 3, http.StatusOK, false},
+		{"empty", "?pretty", "secret", 0, http.StatusOK, true},
+		{"past a flush", "", "secret", exportFlushRows + 1, http.StatusOK, false},
+		{"invalid pretty", "?pretty=very", "secret", 3, http.StatusBadRequest, false},
+		{"wrong key", "", "guess", 3, http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.APIKey = "secret"
+			h, ds := newTestRouter(t, WithConfig(cfg))
+			if tt.students > 0 {
+				seedStudents(t, ds, tt.students)
+			}
+
+			rec := serve(h, http.MethodGet, "/admin/export.json"+tt.query, "", "X-API-Key", tt.key)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment; filename=") {
+				t.Errorf("Content-Disposition %q, want an attachment", got)
+			}
+
+			var students []Student
+			if err := json.Unmarshal(rec.Body.Bytes(), &students); err != nil {
+				t.Fatalf("export is not a JSON array: %v\n%.300s", err, rec.Body)
+			}
+			if len(students) != tt.students {
+				t.Errorf("exported %d students, want %d", len(students), tt.students)
+			}
+			if pretty := strings.Contains(rec.Body.String(), "\n  "); pretty != tt.wantPretty && tt.students > 0 {
+				t.Errorf("indented %v, want %v", pretty, tt.wantPretty)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// studentFields is the whitelist of fields that can be selected with ?fields=.
+var studentFields = []string{"nim", "name", "age", "address", "created_at", "updated_at"}
+
+// parseFields reads a comma separated ?fields= list, followed by the
+// computed fields asked for with ?include=. It returns nil when neither
+// parameter is present, meaning every stored field.
+func parseFields(r *http.Request) ([]string, error) {
+	fields, err := parseStoredFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	include, err := parseInclude(r)
+	if err != nil || include == nil {
+		return fields, err
+	}
+	if fields == nil {
+		fields = append([]string{}, studentFields...)
+	}
+	return append(fields, include...), nil
+}
+
+func parseStoredFields(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	seen := map[string]bool{}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
+		}
+		if !isStudentField(f) {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		seen[f] = true
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func isStudentField(name string) bool {
+	for _, f := range studentFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Student) field(name string) any {
+	switch name {
+	case "nim":
+		return s.NIM
+	case "name":
+		return s.Name
+	case "age":
+		return s.Age
+	case "address":
+		return s.Address
+	case "created_at":
+		return s.CreatedAt
+	case "updated_at":
+		return s.UpdatedAt
+	}
+	if compute, ok := computedFields[name]; ok {
+		return compute(s)
+	}
+	return nil
+}
+
+// studentView is a student restricted to a set of fields. A nil field list
+// means every field.
+type studentView struct {
+	student Student
+	fields  []string
+	// highlight, when set, is sent along as the highlight member.
+	highlight map[string]string
+	// embedded, when set, is sent along as the embedded member.
+	embedded map[string]any
+}
+
+func (v studentView) attributes() map[string]any {
+	fields := v.fields
+	if fields == nil {
+		fields = studentFields
+	}
+
+	obj := make(map[string]any, len(fields))
+	for _, f := range fields {
+		obj[f] = v.student.field(f)
+	}
+	if v.highlight != nil {
+		obj["highlight"] = v.highlight
+	}
+	if v.embedded != nil {
+		obj["embedded"] = v.embedded
+	}
+	return obj
+}
+
+func (v studentView) MarshalJSON() ([]byte, error) {
+	if v.fields == nil && v.highlight == nil && v.embedded == nil {
+		return json.Marshal(v.student)
+	}
+
+	// Highlight markers are usually HTML, which json.Marshal would escape.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v.attributes()); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// selectFields restricts s to fields for serialization.
+func selectFields(s Student, fields []string) studentView {
+	return studentView{student: s, fields: fields}
+}
+
+func selectFieldsAll(students []Student, fields []string) []studentView {
+	views := make([]studentView, len(students))
+	for i, s := range students {
+		views[i] = selectFields(s, fields)
+	}
+	return views
+}
@@ -0,0 +1,38 @@
+package main
+
+import "net/http"
+
+// fieldConstraints describes the rules a field of a student must follow,
+// for clients building forms.
+type fieldConstraints struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Required  bool   `json:"required"`
+	MaxLength int    `json:"max_length,omitempty"`
+	Minimum   int    `json:"minimum,omitempty"`
+	Maximum   int    `json:"maximum,omitempty"`
+	// Pattern is the NIM_PATTERN a NIM must match as a whole.
+	Pattern string `json:"pattern,omitempty"`
+	// Default is used when the field is left empty.
+	Default string `json:"default,omitempty"`
+}
+
+type studentSchema struct {
+	Fields []fieldConstraints `json:"fields"`
+}
+
+// studentSchema describes the fields of a student as Validate and the
+// configuration check them. A NIM is only required when none is generated,
+// and an address only without DEFAULT_ADDRESS.
+func (h *handler) studentSchema() studentSchema {
+	return studentSchema{Fields: []fieldConstraints{
+		{Name: "nim", Type: "string", Required: h.cfg.NIMStrategy == nimStrategyNone, MaxLength: maxNIMLength, Pattern: h.cfg.NIMPattern},
+		{Name: "name", Type: "string", Required: true, MaxLength: maxNameLength},
+		{Name: "age", Type: "integer", Required: true, Minimum: minStudentAge, Maximum: maxStudentAge},
+		{Name: "address", Type: "string", Required: h.cfg.DefaultAddress == "", MaxLength: maxAddressLength, Default: h.cfg.DefaultAddress},
+	}}
+}
+
+func (h *handler) getSchema(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, r, http.StatusOK, h.studentSchema())
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxAddressFilters caps how many address values one request may filter by,
+// for address and address_not each.
+const maxAddressFilters = 50
+
+// studentFilter restricts which students a listing or export returns. Zero
+// fields do not filter.
+type studentFilter struct {
+	// ModifiedSince keeps students updated at or after it.
+	ModifiedSince time.Time
+	// CreatedFrom and CreatedBefore keep students created in [from, before).
+	CreatedFrom   time.Time
+	CreatedBefore time.Time
+	// CreatedTo keeps students created at or before it.
+	CreatedTo time.Time
+	// Query keeps students whose NIM, name or address contains it, ignoring
+	// case.
+	Query string
+	// Name keeps students whose name contains it, ignoring case.
+	Name string
+	// NameRegex keeps students whose name matches it, using Go's RE2
+	// syntax.
+	NameRegex string
+	// NIMPrefix keeps students whose NIM starts with it, e.g. the digits of
+	// a cohort year. Like Name it ignores ASCII case.
+	NIMPrefix string
+	MinAge    uint16
+	MaxAge    uint16
+	// Addresses keeps students living at any of them, matched exactly.
+	Addresses []string
+	// ExcludedAddresses drops students living at any of them, matched
+	// exactly.
+	ExcludedAddresses []string
+}
+
+// conditions returns the SQL conditions the filter imposes, to be joined with
+// AND, and their arguments.
+func (f studentFilter) conditions() ([]string, []any) {
+	var conds []string
+	var args []any
+
+	if !f.ModifiedSince.IsZero() {
+		conds = append(conds, "updated_at >= ?")
+		args = append(args, formatTimestamp(f.ModifiedSince))
+	}
+	if !f.CreatedFrom.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, formatTimestamp(f.CreatedFrom))
+	}
+	if !f.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, formatTimestamp(f.CreatedBefore))
+	}
+	if !f.CreatedTo.IsZero() {
+		conds = append(conds, "created_at <= ?")
+		args = append(args, formatTimestamp(f.CreatedTo))
+	}
+	if f.Query != "" {
+		conds = append(conds, `(nim LIKE ? ESCAPE '\' OR name LIKE ? ESCAPE '\' OR address LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(f.Query) + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+	if f.Name != "" {
+		conds = append(conds, `name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(f.Name)+"%")
+	}
+	if f.NameRegex != "" {
+		conds = append(conds, "name REGEXP ?")
+		args = append(args, f.NameRegex)
+	}
+	if f.NIMPrefix != "" {
+		// The pattern is bound whole rather than built in SQL, which
+		// would keep SQLite from turning it into an index range.
+		conds = append(conds, `nim LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(f.NIMPrefix)+"%")
+	}
+	if f.MinAge > 0 {
+		conds = append(conds, "age >= ?")
+		args = append(args, f.MinAge)
+	}
+	if f.MaxAge > 0 {
+		conds = append(conds, "age <= ?")
+		args = append(args, f.MaxAge)
+	}
+
+	if len(f.Addresses) > 0 {
+		conds = append(conds, "address IN ("+placeholders(len(f.Addresses))+")")
+		for _, a := range f.Addresses {
+			args = append(args, a)
+		}
+	}
+	if len(f.ExcludedAddresses) > 0 {
+		conds = append(conds, "address NOT IN ("+placeholders(len(f.ExcludedAddresses))+")")
+		for _, a := range f.ExcludedAddresses {
+			args = append(args, a)
+		}
+	}
+
+	return conds, args
+}
+
+// placeholders returns n comma separated bind parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// escapeLike escapes the LIKE wildcards in s so that it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// parseFilter reads the filter query parameters shared by the JSON listing
+// and the CSV export.
+func parseFilter(r *http.Request) (studentFilter, error) {
+	var f studentFilter
+	var err error
+	q := r.URL.Query()
+
+	if f.ModifiedSince, err = parseModifiedSince(r); err != nil {
+		return studentFilter{}, err
+	}
+
+	if f.CreatedFrom, err = parseTimestamp(q.Get("created_from"), "created_from"); err != nil {
+		return studentFilter{}, err
+	}
+	if f.CreatedTo, err = parseTimestamp(q.Get("created_to"), "created_to"); err != nil {
+		return studentFilter{}, err
+	}
+	if !f.CreatedFrom.IsZero() && !f.CreatedTo.IsZero() && f.CreatedFrom.After(f.CreatedTo) {
+		return studentFilter{}, fmt.Errorf("created_from must not be after created_to")
+	}
+
+	f.Query = strings.TrimSpace(q.Get("q"))
+	f.Name = strings.TrimSpace(q.Get("name"))
+
+	// The pattern is compiled here so that a bad one is a 400 rather than
+	// a query failure.
+	if f.NameRegex = q.Get("name_regex"); f.NameRegex != "" {
+		if len(f.NameRegex) > maxRegexpLength {
+			return studentFilter{}, fmt.Errorf("name_regex must not be longer than %d bytes", maxRegexpLength)
+		}
+		if _, err := regexp.Compile(f.NameRegex); err != nil {
+			return studentFilter{}, fmt.Errorf("name_regex is not a valid regular expression: %v", err)
+		}
+	}
+
+	if q.Has("nim_prefix") {
+		f.NIMPrefix = strings.TrimSpace(q.Get("nim_prefix"))
+		if f.NIMPrefix == "" || utf8.RuneCountInString(f.NIMPrefix) > maxNIMLength {
+			return studentFilter{}, fmt.Errorf("nim_prefix must be 1 to %d characters", maxNIMLength)
+		}
+	}
+
+	if f.MinAge, err = parseAge(q.Get("min_age"), "min_age"); err != nil {
+		return studentFilter{}, err
+	}
+	if f.MaxAge, err = parseAge(q.Get("max_age"), "max_age"); err != nil {
+		return studentFilter{}, err
+	}
+	if f.MinAge > 0 && f.MaxAge > 0 && f.MinAge > f.MaxAge {
+		return studentFilter{}, fmt.Errorf("min_age must not be greater than max_age")
+	}
+
+	if f.Addresses, err = parseAddresses(q["address"], "address"); err != nil {
+		return studentFilter{}, err
+	}
+	if f.ExcludedAddresses, err = parseAddresses(q["address_not"], "address_not"); err != nil {
+		return studentFilter{}, err
+	}
+	// Both lists combine, so an address in both would be asked for and
+	// excluded at once; that is a mistake rather than a filter.
+	for _, a := range f.ExcludedAddresses {
+		if containsString(f.Addresses, a) {
+			return studentFilter{}, fmt.Errorf("address %q is both included and excluded", a)
+		}
+	}
+
+	return f, nil
+}
+
+// parseAddresses reads the values of a repeatable address parameter,
+// dropping empty ones.
+func parseAddresses(values []string, param string) ([]string, error) {
+	var addresses []string
+	for _, a := range values {
+		if a = strings.TrimSpace(a); a != "" {
+			addresses = append(addresses, a)
+		}
+	}
+	if len(addresses) > maxAddressFilters {
+		return nil, fmt.Errorf("at most %d %s values are allowed", maxAddressFilters, param)
+	}
+	return addresses, nil
+}
+
+// parseModifiedSince reads the optional modified_since query parameter.
+func parseModifiedSince(r *http.Request) (time.Time, error) {
+	return parseTimestamp(r.URL.Query().Get("modified_since"), "modified_since")
+}
+
+// parseTimestamp reads an optional RFC 3339 query parameter.
+func parseTimestamp(v string, param string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+	}
+	return t, nil
+}
+
+func parseAge(v string, param string) (uint16, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	age, err := strconv.ParseUint(v, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a non-negative integer", param)
+	}
+	return uint16(age), nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// filterStudents are the students the filter tests list.
+var filterStudents = []Student{
+	{NIM: "1301", Name: "Ana", Age: 19, Address: "Bandung"},
+	{NIM: "1302", Name: "Budi", Age: 22, Address: "Jakarta"},
+	{NIM: "1303", Name: "Citra", Age: 30, Address: "Medan"},
+	{NIM: "1304", Name: "Dewi", Age: 45, Address: "Bandung"},
+	{NIM: "1305", Name: "Eko", Age: 21, Address: "Surabaya"},
+}
+
+func TestAddressFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{"one address", "?address=Bandung", http.StatusOK, []string{"1301", "1304"}},
+		{"several addresses", "?address=Bandung&address=Medan&address=Jakarta", http.StatusOK, []string{"1301", "1302", "1303", "1304"}},
+		{"unknown address", "?address=Bandung&address=Bogor", http.StatusOK, []string{"1301", "1304"}},
+		{"exact match only", "?address=bandung", http.StatusOK, []string{}},
+		{"blank values ignored", "?address=&address=Medan", http.StatusOK, []string{"1303"}},
+		{"with other filters", "?address=Bandung&address=Surabaya&max_age=25", http.StatusOK, []string{"1301", "1305"}},
+		{"too many", "?address=" + strings.Repeat("x&address=", maxAddressFilters) + "x", http.StatusBadRequest, nil},
+		{"excluded address", "?address_not=Bandung", http.StatusOK, []string{"1302", "1303", "1305"}},
+		{"several excluded addresses", "?address_not=Bandung&address_not=Medan", http.StatusOK, []string{"1302", "1305"}},
+		{"included and excluded", "?address=Bandung&address=Medan&address_not=Jakarta", http.StatusOK, []string{"1301", "1303", "1304"}},
+		{"excluded with other filters", "?address_not=Jakarta&max_age=25", http.StatusOK, []string{"1301", "1305"}},
+		{"included and excluded at once", "?address=Bandung&address_not=Bandung", http.StatusBadRequest, nil},
+		{"too many excluded", "?address_not=" + strings.Repeat("x&address_not=", maxAddressFilters) + "x", http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds, filterStudents...)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := listNIMs(t, rec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+
+			rec = serve(h, http.MethodGet, "/students.csv"+tt.query, "")
+			if got := exportNIMs(t, rec.Body.String()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameRegexFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		wantStatus int
+		want       []string
+	}{
+		{"anchored", "^[A-C]", http.StatusOK, []string{"1301", "1302", "1303"}},
+		{"alternation", "^(Ana|Eko)$", http.StatusOK, []string{"1301", "1305"}},
+		{"case-insensitive flag", "(?i)^dew", http.StatusOK, []string{"1304"}},
+		{"no match", "^Z", http.StatusOK, []string{}},
+		{"invalid", "(", http.StatusBadRequest, nil},
+		{"too long", strings.Repeat("a", maxRegexpLength+1), http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds, filterStudents...)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students?name_regex="+url.QueryEscape(tt.pattern), "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := listNIMs(t, rec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNIMPrefixFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{"shared prefix", "?nim_prefix=2021", http.StatusOK, []string{"2021001", "2021002", "2021013"}},
+		{"longer prefix", "?nim_prefix=202100", http.StatusOK, []string{"2021001", "2021002"}},
+		{"whole NIM", "?nim_prefix=2022001", http.StatusOK, []string{"2022001"}},
+		{"wildcards are literal", "?nim_prefix=20_1", http.StatusOK, []string{}},
+		{"percent is literal", "?nim_prefix=%25", http.StatusOK, []string{}},
+		{"with other filters", "?nim_prefix=2021&max_age=20", http.StatusOK, []string{"2021001", "2021013"}},
+		{"empty", "?nim_prefix=", http.StatusBadRequest, nil},
+		{"blank", "?nim_prefix=%20%20", http.StatusBadRequest, nil},
+		{"too long", "?nim_prefix=" + strings.Repeat("1", maxNIMLength+1), http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds,
+		Student{NIM: "2021001", Name: "Ana", Age: 19, Address: "Bandung"},
+		Student{NIM: "2021002", Name: "Budi", Age: 22, Address: "Jakarta"},
+		Student{NIM: "2021013", Name: "Citra", Age: 20, Address: "Medan"},
+		Student{NIM: "2022001", Name: "Dewi", Age: 19, Address: "Bandung"},
+		Student{NIM: "1202100", Name: "Eko", Age: 21, Address: "Surabaya"},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := listNIMs(t, rec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatedRangeFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{"a month", "?created_from=2026-03-01T00:00:00Z&created_to=2026-03-31T23:59:59.999Z", http.StatusOK, []string{"1302", "1303"}},
+		{"from only", "?created_from=2026-03-31T23:59:59Z", http.StatusOK, []string{"1303", "1304"}},
+		{"to only, inclusive", "?created_to=2026-04-01T00:00:00Z", http.StatusOK, []string{"1301", "1302", "1303", "1304"}},
+		{"to before a creation time", "?created_to=2026-03-31T23:59:59.998Z", http.StatusOK, []string{"1301", "1302"}},
+		{"with other filters", "?created_from=2026-03-01T00:00:00Z&address=Bandung", http.StatusOK, []string{"1302", "1304"}},
+		{"from equals to", "?created_from=2026-03-01T00:00:00Z&created_to=2026-03-01T00:00:00Z", http.StatusOK, []string{"1302"}},
+		{"other time zone", "?created_from=2026-03-01T07:00:00%2B07:00&created_to=2026-04-01T06:59:59.999%2B07:00", http.StatusOK, []string{"1302", "1303"}},
+		{"from after to", "?created_from=2026-04-01T00:00:00Z&created_to=2026-03-01T00:00:00Z", http.StatusBadRequest, nil},
+		{"invalid from", "?created_from=2026-03-01", http.StatusBadRequest, nil},
+		{"invalid to", "?created_to=March", http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds,
+		Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Padang"},
+		Student{NIM: "1302", Name: "Budi", Age: 20, Address: "Bandung"},
+		Student{NIM: "1303", Name: "Citra", Age: 20, Address: "Padang"},
+		Student{NIM: "1304", Name: "Dewi", Age: 20, Address: "Bandung"},
+	)
+	for nim, at := range map[string]string{
+		"1301": "2026-02-28T23:59:59.999Z",
+		"1302": "2026-03-01T00:00:00.000Z",
+		"1303": "2026-03-31T23:59:59.999Z",
+		"1304": "2026-04-01T00:00:00.000Z",
+	} {
+		if _, err := ds.StudentSQLite.Exec("UPDATE students SET created_at = ? WHERE nim = ?", at, nim); err != nil {
+			t.Fatalf("set created_at: %v", err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students.csv"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := exportNIMs(t, rec.Body.String()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+
+			rec = serve(h, http.MethodGet, "/students"+tt.query, "")
+			if got := listNIMs(t, rec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
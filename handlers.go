@@ -0,0 +1,778 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type handler struct {
+	datastore *Datastore
+	cfg       config
+	cache     *ttlCache
+	nims      NIMValidator
+	jobs      *jobRunner
+}
+
+// store returns the transaction-scoped datastore when the route runs under
+// txMiddleware and the shared one otherwise, bound to the request context.
+func (h *handler) store(r *http.Request) *Datastore {
+	return datastoreFromContext(r.Context(), h.datastore).
+		WithContext(r.Context()).
+		ForSchool(schoolFromContext(r.Context()))
+}
+
+// applyDefaults fills fields the client left empty with configured defaults.
+// An explicitly empty address counts as omitted.
+func (h *handler) applyDefaults(student *Student) {
+	if strings.TrimSpace(student.Address) == "" {
+		student.Address = h.cfg.DefaultAddress
+	}
+}
+
+// validate checks student like Student.Validate and, once the NIM follows
+// those rules, against the NIM format of the deployment. It is used where a
+// NIM is introduced; students already stored keep being reachable by their
+// NIM if the format changes later.
+func (h *handler) validate(student Student) error {
+	errs, _ := student.Validate().(ValidationErrors)
+	if errs["nim"] == "" {
+		if err := h.nims.Validate(student.NIM); err != nil {
+			if errs == nil {
+				errs = ValidationErrors{}
+			}
+			errs["nim"] = err.Error()
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (h *handler) createStudent(w http.ResponseWriter, r *http.Request) {
+	student, err := decodeStudent(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+	h.applyDefaults(&student)
+
+	store := h.store(r)
+	generate := strings.TrimSpace(student.NIM) == "" && h.cfg.NIMStrategy != nimStrategyNone
+	if generate {
+		if student.NIM, err = h.nextNIM(store); err != nil {
+			respondDatastoreError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.validate(student); err != nil {
+		respondValidationError(w, r, err.(ValidationErrors))
+		return
+	}
+
+	err = store.Save(student)
+	// A generated NIM may collide with an existing one; draw another.
+	for attempt := 1; generate && isConstraintError(err) && attempt < maxNIMAttempts; attempt++ {
+		if student.NIM, err = h.nextNIM(store); err != nil {
+			break
+		}
+		err = store.Save(student)
+	}
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	// JSON:API clients expect the created resource back, timestamps
+	// included; everyone else keeps getting the bare NIM.
+	if wantsJSONAPI(r) {
+		created, err := store.FindByNIM(student.NIM)
+		if err != nil {
+			respondDatastoreError(w, r, err)
+			return
+		}
+		respondJSON(w, r, http.StatusCreated, selectFields(created, nil))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(student.NIM))
+}
+
+func (h *handler) createStudents(w http.ResponseWriter, r *http.Request) {
+	students, err := decodeStudents(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+	if len(students) > h.cfg.MaxBatchSize {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("batch exceeds maximum of %d items", h.cfg.MaxBatchSize))
+		return
+	}
+
+	errs := ValidationErrors{}
+	for i := range students {
+		h.applyDefaults(&students[i])
+		if err := h.validate(students[i]); err != nil {
+			for field, msg := range err.(ValidationErrors) {
+				errs[fmt.Sprintf("[%d].%s", i, field)] = msg
+			}
+		}
+	}
+	if len(errs) > 0 {
+		respondValidationError(w, r, errs)
+		return
+	}
+
+	if err := h.store(r).SaveBatch(students); err != nil {
+		if isConstraintError(err) {
+			respondError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusCreated, map[string]int{"created": len(students)})
+}
+
+type batchUpdateResult struct {
+	Updated  int      `json:"updated"`
+	NotFound []string `json:"not_found"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// updateStudents updates an array of students by NIM in one transaction.
+// In the default strict mode a NIM that does not exist rolls the whole batch
+// back with 404; with ?mode=besteffort such NIMs are skipped and reported.
+func (h *handler) updateStudents(w http.ResponseWriter, r *http.Request) {
+	var strict bool
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "strict":
+		strict = true
+	case "besteffort":
+	default:
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown mode %q, expected strict or besteffort", mode))
+		return
+	}
+
+	students, err := decodeStudents(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+	if len(students) > h.cfg.MaxBatchSize {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("batch exceeds maximum of %d items", h.cfg.MaxBatchSize))
+		return
+	}
+
+	errs := ValidationErrors{}
+	for i := range students {
+		h.applyDefaults(&students[i])
+		if err := students[i].Validate(); err != nil {
+			for field, msg := range err.(ValidationErrors) {
+				errs[fmt.Sprintf("[%d].%s", i, field)] = msg
+			}
+		}
+	}
+	if len(errs) > 0 {
+		respondValidationError(w, r, errs)
+		return
+	}
+
+	notFound, err := h.store(r).UpdateBatch(students, strict)
+	if errors.Is(err, errDataNotFound) {
+		respondJSON(w, r, http.StatusNotFound, batchUpdateResult{
+			NotFound: notFound,
+			Error:    "some students were not found, nothing was updated",
+		})
+		return
+	}
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, batchUpdateResult{
+		Updated:  len(students) - len(notFound),
+		NotFound: notFound,
+	})
+}
+
+func (h *handler) validateStudent(w http.ResponseWriter, r *http.Request) {
+	student, err := decodeStudent(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+	h.applyDefaults(&student)
+
+	if err := h.validate(student); err != nil {
+		respondValidationError(w, r, err.(ValidationErrors))
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, map[string]bool{"valid": true})
+}
+
+// batchValidation is the verdict on one student of a batch, identified by
+// its position in the array.
+type batchValidation struct {
+	Index  int          `json:"index"`
+	Valid  bool         `json:"valid"`
+	Errors []fieldError `json:"errors,omitempty"`
+}
+
+type fieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// validateStudents checks every student of a batch like POST /students/batch
+// would, without saving any, so a client can point out the failing rows
+// before importing. It answers 200 even when rows fail; the verdicts are
+// the result.
+func (h *handler) validateStudents(w http.ResponseWriter, r *http.Request) {
+	students, err := decodeStudents(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+	if len(students) > h.cfg.MaxBatchSize {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("batch exceeds maximum of %d items", h.cfg.MaxBatchSize))
+		return
+	}
+
+	results := make([]batchValidation, len(students))
+	for i := range students {
+		h.applyDefaults(&students[i])
+		results[i] = batchValidation{Index: i, Valid: true}
+
+		errs, ok := h.validate(students[i]).(ValidationErrors)
+		if !ok {
+			continue
+		}
+		results[i].Valid = false
+		for field, msg := range errs {
+			results[i].Errors = append(results[i].Errors, fieldError{Field: field, Error: msg})
+		}
+		sort.Slice(results[i].Errors, func(a, b int) bool {
+			return results[i].Errors[a].Field < results[i].Errors[b].Field
+		})
+	}
+
+	respondJSON(w, r, http.StatusOK, results)
+}
+
+// deleteStudent deletes the student named in the path. Like an update it
+// honors If-Match, so a student changed since the client read it is kept.
+func (h *handler) deleteStudent(w http.ResponseWriter, r *http.Request) {
+	nim := chi.URLParam(r, "nim")
+	if !h.checkIfMatch(w, r, nim) {
+		return
+	}
+
+	err := h.store(r).DeleteByNIM(nim)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// readNIMs reads the NIMs of a bulk request, answering 400 itself when they
+// are malformed or more than MaxBatchSize.
+func (h *handler) readNIMs(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	nims, err := decodeNIMs(r.Body)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return nil, false
+	}
+	if len(nims) > h.cfg.MaxBatchSize {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("batch exceeds maximum of %d items", h.cfg.MaxBatchSize))
+		return nil, false
+	}
+	return nims, true
+}
+
+// deleteStudents deletes the students whose NIMs are sent as a JSON array,
+// all or none. NIMs without a student are ignored.
+func (h *handler) deleteStudents(w http.ResponseWriter, r *http.Request) {
+	nims, ok := h.readNIMs(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.store(r).DeleteByNIMs(nims)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+// lookupStudents returns the students whose NIMs are sent as a JSON array.
+// It is a POST because the list can be too long for a URL.
+func (h *handler) lookupStudents(w http.ResponseWriter, r *http.Request) {
+	fields, err := parseFields(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	nims, ok := h.readNIMs(w, r)
+	if !ok {
+		return
+	}
+
+	students, err := h.store(r).FindByNIMs(nims)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, selectFieldsAll(students, fields))
+}
+
+func (h *handler) resetAddress(w http.ResponseWriter, r *http.Request) {
+	nim := chi.URLParam(r, "nim")
+	student, err := h.store(r).ResetAddress(nim, h.cfg.DefaultAddress)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, selectFields(student, nil))
+}
+
+// updateField sets the one field named in the path, for quick edits from the
+// admin panel, e.g. PUT /students/123/age/21. The value must parse as the
+// field's type, otherwise it is a 400, and pass the same rules as a full
+// update, otherwise it is a 422.
+func (h *handler) updateField(w http.ResponseWriter, r *http.Request) {
+	nim := chi.URLParam(r, "nim")
+	field := chi.URLParam(r, "field")
+	raw := chi.URLParam(r, "value")
+
+	var value any
+	switch field {
+	case "name", "address":
+		value = raw
+	case "age":
+		age, err := strconv.ParseUint(raw, 10, 16)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, "age must be a whole number")
+			return
+		}
+		value = uint16(age)
+	case "nim":
+		respondError(w, r, http.StatusBadRequest, "the NIM of a student cannot be changed")
+		return
+	default:
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown field %q, expected name, age or address", field))
+		return
+	}
+
+	store := h.store(r)
+	student, err := store.FindByNIM(nim)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	// Only the edited field is checked, so a legacy row breaking some other
+	// rule can still be corrected one field at a time.
+	switch field {
+	case "name":
+		student.Name = raw
+	case "address":
+		student.Address = raw
+	case "age":
+		student.Age = value.(uint16)
+	}
+	if errs, ok := student.Validate().(ValidationErrors); ok && errs[field] != "" {
+		respondValidationError(w, r, ValidationErrors{field: errs[field]})
+		return
+	}
+
+	if !h.checkIfMatch(w, r, nim) {
+		return
+	}
+
+	student, err = store.UpdateField(nim, field, value)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, selectFields(student, nil))
+}
+
+// renameStudent corrects the NIM of a student, e.g. after a data-entry
+// error; every other route treats the NIM as immutable. A new NIM already
+// taken by another student is a 409.
+func (h *handler) renameStudent(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeRename(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+
+	// The new NIM has to pass the same rules as the NIM of a new student.
+	if errs, ok := h.validate(Student{NIM: req.NewNIM}).(ValidationErrors); ok && errs["nim"] != "" {
+		respondValidationError(w, r, ValidationErrors{"new_nim": errs["nim"]})
+		return
+	}
+
+	nim := chi.URLParam(r, "nim")
+	if !h.checkIfMatch(w, r, nim) {
+		return
+	}
+
+	student, err := h.store(r).RenameNIM(nim, req.NewNIM)
+	if err != nil {
+		if isConstraintError(err) {
+			respondError(w, r, http.StatusConflict, fmt.Sprintf("NIM %q is already taken", req.NewNIM))
+			return
+		}
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", studentETag(student))
+	respondJSON(w, r, http.StatusOK, selectFields(student, nil))
+}
+
+func (h *handler) updateStudent(w http.ResponseWriter, r *http.Request) {
+	student, err := decodeStudent(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+
+	h.update(w, r, student)
+}
+
+// replaceStudent updates the student named in the path. A body may leave
+// out the NIM, but one that names a different student is a 409: the NIM
+// cannot be changed, and guessing which of the two was meant could edit the
+// wrong record.
+func (h *handler) replaceStudent(w http.ResponseWriter, r *http.Request) {
+	nim := chi.URLParam(r, "nim")
+	student, err := decodeStudent(r.Body, h.cfg.RejectDuplicateFields)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), describeDecodeError(err))
+		return
+	}
+
+	sameNIM := student.NIM == nim || h.cfg.NIMCaseInsensitive && strings.EqualFold(student.NIM, nim)
+	switch {
+	case student.NIM == "":
+		student.NIM = nim
+	case !sameNIM:
+		respondError(w, r, http.StatusConflict, fmt.Sprintf("body NIM %q does not match path NIM %q, a NIM cannot be changed", student.NIM, nim))
+		return
+	}
+
+	h.update(w, r, student)
+}
+
+// update validates student and stores it over the student with its NIM.
+// Like a new student, it gets DEFAULT_ADDRESS when its address is empty.
+func (h *handler) update(w http.ResponseWriter, r *http.Request, student Student) {
+	h.applyDefaults(&student)
+	if err := student.Validate(); err != nil {
+		respondValidationError(w, r, err.(ValidationErrors))
+		return
+	}
+
+	if !h.checkIfMatch(w, r, student.NIM) {
+		return
+	}
+
+	updated, err := h.store(r).UpdateByNIM(student)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, map[string]int64{"updated": updated})
+}
+
+func (h *handler) listStudents(w http.ResponseWriter, r *http.Request) {
+	h.respondList(w, r, nil)
+}
+
+// studentsCreatedToday lists the students created since midnight in the
+// configured time zone, for the daily intake dashboard. Paging and the
+// other filters work as on GET /students.
+func (h *handler) studentsCreatedToday(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().In(h.cfg.Timezone)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, h.cfg.Timezone)
+
+	h.respondList(w, r, func(f *studentFilter) {
+		f.CreatedFrom = midnight
+		f.CreatedBefore = midnight.AddDate(0, 0, 1)
+	})
+}
+
+// parseEmptyIs404 reads ?empty_is_404, which makes a list without any
+// matching student a 404 instead of an empty 200. It only looks at the total,
+// so paging past the end of a non-empty list is still a 200.
+func parseEmptyIs404(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("empty_is_404")
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("empty_is_404 must be true or false")
+	}
+	return b, nil
+}
+
+// respondList answers a listing request. restrict, if not nil, narrows the
+// filter parsed from the query.
+func (h *handler) respondList(w http.ResponseWriter, r *http.Request, restrict func(*studentFilter)) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// A Range header takes precedence over limit and offset.
+	rng, partial, err := parseItemsRange(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if partial {
+		limit, offset = rng.Last-rng.First+1, rng.First
+	}
+	paged := partial || pageRequested(r)
+	if !paged {
+		limit = -1
+	}
+
+	fields, err := parseFields(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if restrict != nil {
+		restrict(&filter)
+	}
+
+	emptyIs404, err := parseEmptyIs404(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	highlight, err := parseHighlight(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	q := listQuery{
+		Limit:       limit,
+		Offset:      offset,
+		Filter:      filter,
+		Sort:        h.cfg.DefaultSort,
+		ExpectedAge: h.cfg.ExpectedAge,
+	}
+
+	// In debug mode ?explain=true answers with the query plan instead of
+	// the students, to check which indexes a filter uses. Elsewhere the
+	// parameter is ignored.
+	if h.cfg.Debug && r.URL.Query().Get("explain") == "true" {
+		plan, err := h.store(r).ExplainFindAll(q)
+		if err != nil {
+			respondDatastoreError(w, r, err)
+			return
+		}
+		respondJSON(w, r, http.StatusOK, listResponse{
+			Data: []studentView{},
+			Meta: listMeta{Limit: limit, Offset: offset, ServerTime: now, QueryPlan: plan},
+		})
+		return
+	}
+
+	result, err := h.store(r).FindAll(q)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	if emptyIs404 && result.Total == 0 {
+		respondError(w, r, http.StatusNotFound, "no students match the filter")
+		return
+	}
+
+	if result.Anomalies > 0 {
+		w.Header().Add("Warning", fmt.Sprintf(`199 - "%d students have an age outside %d-%d"`,
+			result.Anomalies, h.cfg.ExpectedAge.Min, h.cfg.ExpectedAge.Max))
+	}
+
+	w.Header().Set("Accept-Ranges", "items")
+
+	data := selectFieldsAll(result.Students, fields)
+	if highlight && filter.Query != "" {
+		for i := range data {
+			data[i].highlight = highlightMatches(data[i].student, filter.Query, h.cfg.HighlightPre, h.cfg.HighlightPost)
+		}
+	}
+
+	if !paged {
+		respondJSON(w, r, http.StatusOK, data)
+		return
+	}
+
+	meta := listMeta{Total: result.Total, Limit: limit, Offset: offset, ServerTime: now}
+	meta.Links = pageLinks(r, meta)
+	if link := linkHeader(meta.Links); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	status := http.StatusOK
+	if partial {
+		if len(result.Students) == 0 {
+			w.Header().Set("Content-Range", fmt.Sprintf("items */%d", result.Total))
+			respondError(w, r, http.StatusRequestedRangeNotSatisfiable, "range starts past the last student")
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("items %d-%d/%d",
+			offset, offset+len(result.Students)-1, result.Total))
+	}
+
+	respondJSON(w, r, status, listResponse{
+		Data: data,
+		Meta: meta,
+	})
+}
+
+func (h *handler) getStudent(w http.ResponseWriter, r *http.Request) {
+	fields, err := parseFields(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	embeds, err := parseEmbed(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	nim := chi.URLParam(r, "nim")
+	store := h.store(r)
+	student, err := store.FindByNIM(nim)
+
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	view := selectFields(student, fields)
+	if len(embeds) > 0 {
+		if view.embedded, err = h.embed(store, student, embeds); err != nil {
+			respondDatastoreError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", studentETag(student))
+	respondJSON(w, r, http.StatusOK, view)
+}
+
+// randomStudents returns one random student, or with ?count=N up to N
+// distinct ones as a list. ?weight=age makes older students proportionally
+// more likely to be picked, e.g. for a raffle.
+func (h *handler) randomStudents(w http.ResponseWriter, r *http.Request) {
+	fields, err := parseFields(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	count := 1
+	v := r.URL.Query().Get("count")
+	if v != "" {
+		count, err = strconv.Atoi(v)
+		if err != nil || count < 1 || count > maxPageLimit {
+			respondError(w, r, http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", maxPageLimit))
+			return
+		}
+	}
+
+	weight := r.URL.Query().Get("weight")
+	if weight != "" && !containsString(weightColumns, weight) {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("cannot weigh by %q, expected one of %s", weight, strings.Join(weightColumns, ", ")))
+		return
+	}
+
+	students, err := h.store(r).FindRandom(count, weight)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+	if len(students) == 0 {
+		respondError(w, r, http.StatusNotFound, "there are no students to pick from")
+		return
+	}
+
+	if v == "" {
+		respondJSON(w, r, http.StatusOK, selectFields(students[0], fields))
+		return
+	}
+	respondJSON(w, r, http.StatusOK, selectFieldsAll(students, fields))
+}
+
+const defaultSimilarLimit = 10
+
+// similarStudents lists the students sharing an address with the given
+// one or close to their age, for recommendations.
+func (h *handler) similarStudents(w http.ResponseWriter, r *http.Request) {
+	fields, err := parseFields(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := defaultSimilarLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+	}
+
+	students, err := h.store(r).FindSimilar(chi.URLParam(r, "nim"), limit)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, selectFieldsAll(students, fields))
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestStatusConvention checks that a request that cannot be parsed gets 400
+// and one that parses but fails validation gets 422, on every endpoint that
+// takes students.
+func TestStatusConvention(t *testing.T) {
+	const badAge = `{"nim":"1399","name":"Ana","age":3,"address":"Bandung"}`
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"create, bad JSON", http.MethodPost, "/students", `{"nim":`, http.StatusBadRequest},
+		{"create, wrong type", http.MethodPost, "/students", `{"nim":"1399","age":true}`, http.StatusBadRequest},
+		{"create, age out of range", http.MethodPost, "/students", badAge, http.StatusUnprocessableEntity},
+		{"create, missing name", http.MethodPost, "/students", `{"nim":"1399","age":20,"address":"Bandung"}`, http.StatusUnprocessableEntity},
+		{"update, bad JSON", http.MethodPut, "/students", `{"nim":"1301",}`, http.StatusBadRequest},
+		{"update, age out of range", http.MethodPut, "/students", `{"nim":"1301","name":"Ana","age":101,"address":"Bandung"}`, http.StatusUnprocessableEntity},
+		{"validate, bad JSON", http.MethodPost, "/students/validate", `{`, http.StatusBadRequest},
+		{"validate, age out of range", http.MethodPost, "/students/validate", badAge, http.StatusUnprocessableEntity},
+		{"batch create, bad JSON", http.MethodPost, "/students/batch", `[{"nim":"1399"`, http.StatusBadRequest},
+		{"batch create, age out of range", http.MethodPost, "/students/batch", `[` + badAge + `]`, http.StatusUnprocessableEntity},
+		{"batch update, bad JSON", http.MethodPut, "/students/batch", `[1]`, http.StatusBadRequest},
+		{"batch update, age out of range", http.MethodPut, "/students/batch", `[{"nim":"1301","name":"Ana","age":3,"address":"Bandung"}]`, http.StatusUnprocessableEntity},
+		{"import, bad CSV", http.MethodPost, "/students/import", "nim,name,age,address\n1399,Ana,\"20\n", http.StatusBadRequest},
+		{"import, age not a number", http.MethodPost, "/students/import", "nim,name,age,address\n1399,Ana,twenty,Bandung\n", http.StatusBadRequest},
+		{"import, age out of range", http.MethodPost, "/students/import", "nim,name,age,address\n1399,Ana,3,Bandung\n", http.StatusUnprocessableEntity},
+	}
+
+	h, _ := newTestRouter(t)
+	if rec := serve(h, http.MethodPost, "/students", studentJSON("1301")); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestBatchSizeCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"create at the cap", http.MethodPost, batchJSON("1", "2", "3"), http.StatusCreated, ""},
+		{"create over the cap", http.MethodPost, batchJSON("4", "5", "6", "7"), http.StatusBadRequest, "batch exceeds maximum of 3 items"},
+		{"invalid students over the cap", http.MethodPost, `[{},{},{},{}]`, http.StatusBadRequest, "batch exceeds maximum of 3 items"},
+		{"update at the cap", http.MethodPut, batchJSON("1", "2", "3"), http.StatusOK, ""},
+		{"update over the cap", http.MethodPut, batchJSON("1", "2", "3", "4"), http.StatusBadRequest, "batch exceeds maximum of 3 items"},
+	}
+
+	cfg := testConfig()
+	cfg.MaxBatchSize = 3
+	h, ds := newTestRouter(t, WithConfig(cfg))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, "/students/batch", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError != "" {
+				var got errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Error != tt.wantError {
+					t.Errorf("body %s, want error %q", rec.Body, tt.wantError)
+				}
+			}
+			if n := countStudents(t, ds); n != 3 {
+				t.Errorf("%d students stored, want 3", n)
+			}
+		})
+	}
+}
+
+func TestNIMCase(t *testing.T) {
+	tests := []struct {
+		name       string
+		ignoreCase bool
+		method     string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"exact lookup", false, http.MethodGet, "/students/ABC123", "", http.StatusOK},
+		{"lookup in other case", false, http.MethodGet, "/students/abc123", "", http.StatusNotFound},
+		{"lookup ignoring case", true, http.MethodGet, "/students/abc123", "", http.StatusOK},
+		{"mixed case ignoring case", true, http.MethodGet, "/students/AbC123", "", http.StatusOK},
+		{"update ignoring case", true, http.MethodPut, "/students", `{"nim":"abc123","name":"Budi","age":21,"address":"Padang"}`, http.StatusOK},
+		{"address reset ignoring case", true, http.MethodDelete, "/students/abc123/address", "", http.StatusOK},
+		{"delete ignoring case", true, http.MethodDelete, "/students/abc123", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ds := newTestRouter(t)
+			if tt.ignoreCase {
+				ds.IgnoreNIMCase()
+			}
+			addStudents(t, ds, Student{NIM: "ABC123", Name: "Ana", Age: 20, Address: "Bandung"})
+
+			rec := serve(h, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.method == http.MethodGet && tt.wantStatus == http.StatusOK && !strings.Contains(rec.Body.String(), `"nim":"ABC123"`) {
+				t.Errorf("body %s, want the student stored as ABC123", rec.Body)
+			}
+		})
+	}
+
+	t.Run("update reaches the stored row", func(t *testing.T) {
+		h, ds := newTestRouter(t)
+		ds.IgnoreNIMCase()
+		addStudents(t, ds, Student{NIM: "ABC123", Name: "Ana", Age: 20, Address: "Bandung"})
+
+		serve(h, http.MethodPut, "/students", `{"nim":"abc123","name":"Budi","age":21,"address":"Padang"}`)
+		got, err := ds.FindByNIM("ABC123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Budi" {
+			t.Errorf("name %q after update, want Budi", got.Name)
+		}
+	})
+}
+
+func TestEmptyIs404(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantNIMs   []string
+	}{
+		{"no match", "?name=nobody", http.StatusOK, []string{}},
+		{"no match, 404 asked for", "?name=nobody&empty_is_404=true", http.StatusNotFound, nil},
+		{"no match, 404 turned off", "?name=nobody&empty_is_404=false", http.StatusOK, []string{}},
+		{"match, 404 asked for", "?name=ana&empty_is_404=true", http.StatusOK, []string{"1301"}},
+		{"past the end, 404 asked for", "?offset=10&empty_is_404=true", http.StatusOK, []string{}},
+		{"invalid value", "?empty_is_404=maybe", http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantNIMs == nil {
+				return
+			}
+			if got := listNIMs(t, rec); !reflect.DeepEqual(got, tt.wantNIMs) {
+				t.Errorf("listed %v, want %v", got, tt.wantNIMs)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		name     string
+		debug    bool
+		query    string
+		wantPlan bool
+	}{
+		{"debug off", false, "?limit=10&explain=true", false},
+		{"debug on", true, "?limit=10&explain=true", true},
+		{"debug on, not asked", true, "?limit=10", false},
+		{"debug on, explain false", true, "?limit=10&explain=false", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Debug = tt.debug
+			h, ds := newTestRouter(t, WithConfig(cfg))
+			addStudents(t, ds, filterStudents...)
+
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				Data []json.RawMessage `json:"data"`
+				Meta struct {
+					QueryPlan []queryPlanStep `json:"query_plan"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+
+			if tt.wantPlan {
+				if len(resp.Meta.QueryPlan) == 0 {
+					t.Errorf("no query plan in %s", rec.Body)
+				}
+				if len(resp.Data) != 0 {
+					t.Errorf("got %d students, want none when explaining", len(resp.Data))
+				}
+				return
+			}
+			if resp.Meta.QueryPlan != nil {
+				t.Errorf("query plan %v, want none", resp.Meta.QueryPlan)
+			}
+			if len(resp.Data) != len(filterStudents) {
+				t.Errorf("got %d students, want %d", len(resp.Data), len(filterStudents))
+			}
+		})
+	}
+}
+
+func TestUpdateField(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		want       Student
+	}{
+		{"age", "/students/1301/age/21", http.StatusOK, Student{NIM: "1301", Name: "Ana", Age: 21, Address: "Bandung"}},
+		{"name", "/students/1301/name/Budi", http.StatusOK, Student{NIM: "1301", Name: "Budi", Age: 20, Address: "Bandung"}},
+		{"escaped address", "/students/1301/address/Jalan%20Merdeka", http.StatusOK, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Jalan Merdeka"}},
+		{"age not a number", "/students/1301/age/old", http.StatusBadRequest, Student{}},
+		{"age out of range", "/students/1301/age/70000", http.StatusBadRequest, Student{}},
+		{"age fails validation", "/students/1301/age/3", http.StatusUnprocessableEntity, Student{}},
+		{"nim", "/students/1301/nim/1302", http.StatusBadRequest, Student{}},
+		{"unknown field", "/students/1301/email/ana@example.com", http.StatusBadRequest, Student{}},
+		{"unknown student", "/students/1399/age/21", http.StatusNotFound, Student{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ds := newTestRouter(t)
+			stored := Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"}
+			addStudents(t, ds, stored)
+
+			rec := serve(h, http.MethodPut, tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			want := tt.want
+			if tt.wantStatus != http.StatusOK {
+				want = stored
+			}
+			got, err := ds.FindByNIM("1301")
+			if err != nil {
+				t.Fatalf("find: %v", err)
+			}
+			if got.Name != want.Name || got.Age != want.Age || got.Address != want.Address {
+				t.Errorf("stored %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReplaceStudent(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+		wantName   string
+	}{
+		{"matching NIM", "/students/1301", `{"nim":"1301","name":"Budi","age":21,"address":"Padang"}`, http.StatusOK, "Budi"},
+		{"NIM left out", "/students/1301", `{"name":"Budi","age":21,"address":"Padang"}`, http.StatusOK, "Budi"},
+		{"mismatched NIM", "/students/1301", `{"nim":"1302","name":"Budi","age":21,"address":"Padang"}`, http.StatusConflict, "Ana"},
+		{"NIM extending the path NIM", "/students/1301", `{"nim":"1301A","name":"Budi","age":21,"address":"Padang"}`, http.StatusConflict, "Ana"},
+		{"invalid", "/students/1301", `{"name":"Budi","age":3,"address":"Padang"}`, http.StatusUnprocessableEntity, "Ana"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ds := newTestRouter(t)
+			addStudents(t, ds,
+				Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"},
+				Student{NIM: "1302", Name: "Citra", Age: 22, Address: "Medan"},
+			)
+
+			rec := serve(h, http.MethodPut, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if got, err := ds.FindByNIM("1301"); err != nil || got.Name != tt.wantName {
+				t.Errorf("1301 is %+v, %v, want name %s", got, err, tt.wantName)
+			}
+			// The student a mismatched body names is never touched.
+			if got, err := ds.FindByNIM("1302"); err != nil || got.Name != "Citra" {
+				t.Errorf("1302 is %+v, %v, want it unchanged", got, err)
+			}
+		})
+	}
+}
+
+func TestRenameStudent(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		header     []string
+		wantStatus int
+		// want are the NIMs stored afterwards.
+		want []string
+	}{
+		{"success", "/students/1301/rename", `{"new_nim":"1310"}`, nil, http.StatusOK, []string{"1302", "1310"}},
+		{"collision", "/students/1301/rename", `{"new_nim":"1302"}`, nil, http.StatusConflict, []string{"1301", "1302"}},
+		{"same NIM", "/students/1301/rename", `{"new_nim":"1301"}`, nil, http.StatusOK, []string{"1301", "1302"}},
+		{"missing new NIM", "/students/1301/rename", `{}`, nil, http.StatusUnprocessableEntity, []string{"1301", "1302"}},
+		{"new NIM too long", "/students/1301/rename", `{"new_nim":"` + strings.Repeat("1", maxNIMLength+1) + `"}`, nil, http.StatusUnprocessableEntity, []string{"1301", "1302"}},
+		{"malformed body", "/students/1301/rename", `{"new_nim":`, nil, http.StatusBadRequest, []string{"1301", "1302"}},
+		{"unknown student", "/students/1399/rename", `{"new_nim":"1310"}`, nil, http.StatusNotFound, []string{"1301", "1302"}},
+		{"stale If-Match", "/students/1301/rename", `{"new_nim":"1310"}`, []string{"If-Match", `"0123456789abcdef"`}, http.StatusPreconditionFailed, []string{"1301", "1302"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ds := newTestRouter(t)
+			addStudents(t, ds,
+				Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"},
+				Student{NIM: "1302", Name: "Budi", Age: 21, Address: "Padang"},
+			)
+
+			rec := serve(h, http.MethodPost, tt.target, tt.body, tt.header...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := listNIMs(t, serve(h, http.MethodGet, "/students", "")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stored %v, want %v", got, tt.want)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var renamed Student
+			if err := json.Unmarshal(rec.Body.Bytes(), &renamed); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if renamed.Name != "Ana" || rec.Header().Get("ETag") == "" {
+				t.Errorf("answered %s with ETag %q, want Ana and an ETag", rec.Body, rec.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestBatchValidate(t *testing.T) {
+	const (
+		badAge  = `{"nim":"1302","name":"Budi","age":3,"address":"Padang"}`
+		missing = `{"nim":"","name":"","age":20}`
+	)
+	type verdict struct {
+		Index  int  `json:"index"`
+		Valid  bool `json:"valid"`
+		Errors []struct {
+			Field string `json:"field"`
+		} `json:"errors"`
+	}
+
+	cfg := testConfig()
+	cfg.MaxBatchSize = 3
+	h, ds := newTestRouter(t, WithConfig(cfg))
+
+	rec := serve(h, http.MethodPost, "/students/batch/validate", `[`+studentJSON("1301")+`,`+badAge+`,`+missing+`]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got []verdict
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("%d verdicts, want 3: %s", len(got), rec.Body)
+	}
+
+	wantFields := [][]string{nil, {"age"}, {"address", "name", "nim"}}
+	for i, v := range got {
+		var fields []string
+		for _, e := range v.Errors {
+			fields = append(fields, e.Field)
+		}
+		if v.Index != i || v.Valid != (wantFields[i] == nil) || !reflect.DeepEqual(fields, wantFields[i]) {
+			t.Errorf("verdict %d = %+v, want index %d with errors on %v", i, v, i, wantFields[i])
+		}
+	}
+	if n := countStudents(t, ds); n != 0 {
+		t.Errorf("%d students stored, want none", n)
+	}
+
+	rec = serve(h, http.MethodPost, "/students/batch/validate", batchJSON("1", "2", "3", "4"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("over the cap: status %d, want 400: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUpdateCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   int64
+	}{
+		{"by body", "/students", `{"nim":"1301","name":"Budi","age":21,"address":"Padang"}`, 1},
+		{"by path", "/students/1301", `{"name":"Citra","age":22,"address":"Medan"}`, 1},
+		{"unknown by body", "/students", `{"nim":"1399","name":"Budi","age":21,"address":"Padang"}`, 0},
+		{"unknown by path", "/students/1399", `{"name":"Citra","age":22,"address":"Medan"}`, 0},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodPut, tt.target, tt.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var got struct {
+				Updated *int64 `json:"updated"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Updated == nil || *got.Updated != tt.want {
+				t.Errorf("body %s, want {\"updated\":%d}", rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"create", http.MethodPost, "/students", `{"nim":"1302","name":"Budi","age":21}`},
+		{"create with an empty address", http.MethodPost, "/students", `{"nim":"1302","name":"Budi","age":21,"address":" "}`},
+		{"update by body", http.MethodPut, "/students", `{"nim":"1301","name":"Ana","age":20,"address":""}`},
+		{"update by path", http.MethodPut, "/students/1301", `{"name":"Ana","age":20}`},
+		{"batch update", http.MethodPut, "/students/batch", `[{"nim":"1301","name":"Ana","age":20,"address":""}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.DefaultAddress = "Unknown"
+			h, ds := newTestRouter(t, WithConfig(cfg))
+			addStudents(t, ds, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+
+			rec := serve(h, tt.method, tt.target, tt.body)
+			if rec.Code >= 300 {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+
+			nim := "1301"
+			if tt.method == http.MethodPost {
+				nim = "1302"
+			}
+			student, err := ds.FindByNIM(nim)
+			if err != nil {
+				t.Fatalf("find %s: %v", nim, err)
+			}
+			if student.Address != "Unknown" {
+				t.Errorf("address %q, want DEFAULT_ADDRESS", student.Address)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Mode   string `json:"mode"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthz reports whether the service can serve requests. The default
+// ping mode is cheap enough for frequent liveness probes; ?mode=full also
+// performs a write that is rolled back, so readiness probes notice a
+// database that still answers but no longer accepts writes, e.g. on a
+// filesystem remounted read-only.
+func (h *handler) healthz(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "ping"
+	}
+	if mode != "ping" && mode != "full" {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown mode %q, expected ping or full", mode))
+		return
+	}
+
+	ds := h.datastore.WithContext(r.Context())
+	err := ds.Ping()
+	if err == nil && mode == "full" {
+		err = ds.CheckWritable()
+	}
+	if err != nil {
+		respondJSON(w, r, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Mode: mode, Error: err.Error()})
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, healthStatus{Status: "ok", Mode: mode})
+}
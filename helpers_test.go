@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestDatastore opens a migrated in-memory database that is closed when
+// the test ends.
+func newTestDatastore(t testing.TB) *Datastore {
+	t.Helper()
+
+	ds, err := newDatastore(":memory:", nimScopeGlobal)
+	if err != nil {
+		t.Fatalf("open datastore: %v", err)
+	}
+	t.Cleanup(func() { ds.StudentSQLite.Close() })
+	return ds
+}
+
+// testConfig is the default configuration of a single-tenant deployment,
+// whose requests act for the empty school without an X-School-Id header.
+func testConfig() config {
+	cfg := defaultConfig()
+	cfg.RequireSchoolID = false
+	return cfg
+}
+
+// newTestRouter serves the API from a fresh database with testConfig. The
+// request logger is off to keep test output quiet, and panics are not
+// recovered, so they fail the test.
+func newTestRouter(t testing.TB, opts ...RouterOption) (http.Handler, *Datastore) {
+	t.Helper()
+
+	ds := newTestDatastore(t)
+	opts = append([]RouterOption{WithConfig(testConfig()), WithoutLogger(), WithoutRecoverer()}, opts...)
+	return newRouter(ds, opts...), ds
+}
+
+// serve sends a request with a JSON body to h and returns the recorded
+// response. header holds extra headers as name, value pairs.
+func serve(h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// studentJSON returns the JSON of a valid student with the given NIM.
+func studentJSON(nim string) string {
+	return `{"nim":"` + nim + `","name":"Ana","age":20,"address":"Bandung"}`
+}
+
+// addStudents stores students directly in ds.
+func addStudents(t testing.TB, ds *Datastore, students ...Student) {
+	t.Helper()
+
+	if err := ds.SaveBatch(students); err != nil {
+		t.Fatalf("add students: %v", err)
+	}
+}
+
+// listNIMs returns the NIMs of a GET /students response in order, whether
+// it is a bare array or a page.
+func listNIMs(t testing.TB, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+
+	type item struct {
+		NIM string `json:"nim"`
+	}
+	var resp struct {
+		Data []item `json:"data"`
+	}
+	body := bytes.TrimSpace(rec.Body.Bytes())
+	var err error
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &resp.Data)
+	} else {
+		err = json.Unmarshal(body, &resp)
+	}
+	if err != nil {
+		t.Fatalf("decode list %s: %v", rec.Body, err)
+	}
+	nims := []string{}
+	for _, s := range resp.Data {
+		nims = append(nims, s.NIM)
+	}
+	return nims
+}
+
+// batchJSON returns a JSON array of valid students with the given NIMs.
+func batchJSON(nims ...string) string {
+	items := make([]string, len(nims))
+	for i, nim := range nims {
+		items[i] = studentJSON(nim)
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
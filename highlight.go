@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parseHighlight reads ?highlight, which asks for the matches of ?q= to be
+// marked in each student of a listing.
+func parseHighlight(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("highlight")
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("highlight must be true or false")
+	}
+	return b, nil
+}
+
+// highlightMatches returns the searched fields of s that contain q, each
+// HTML-escaped with every occurrence of q wrapped in pre and post. Like the
+// LIKE query that found s, matching ignores ASCII case only.
+func highlightMatches(s Student, q string, pre, post string) map[string]string {
+	highlights := map[string]string{}
+	for field, value := range map[string]string{"nim": s.NIM, "name": s.Name, "address": s.Address} {
+		if marked, ok := markMatches(value, q, pre, post); ok {
+			highlights[field] = marked
+		}
+	}
+	return highlights
+}
+
+// markMatches wraps every occurrence of q in s and reports whether there
+// was any. The text of s is HTML-escaped, so a student's name cannot inject
+// markup next to the markers; pre and post are inserted as they are.
+func markMatches(s, q, pre, post string) (string, bool) {
+	// Lowering ASCII letters keeps byte offsets, so positions found in the
+	// folded copy apply to s.
+	folded, needle := asciiLower(s), asciiLower(q)
+
+	var b strings.Builder
+	found := false
+	for {
+		i := strings.Index(folded, needle)
+		if i < 0 {
+			break
+		}
+		found = true
+		b.WriteString(html.EscapeString(s[:i]))
+		b.WriteString(pre)
+		b.WriteString(html.EscapeString(s[i : i+len(needle)]))
+		b.WriteString(post)
+		s, folded = s[i+len(needle):], folded[i+len(needle):]
+	}
+	b.WriteString(html.EscapeString(s))
+	return b.String(), found
+}
+
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestMarkMatches(t *testing.T) {
+	tests := []struct {
+		s, q      string
+		want      string
+		wantFound bool
+	}{
+		{"Anna", "an", "<mark>An</mark>na", true},
+		{"Banana", "AN", "B<mark>an</mark><mark>an</mark>a", true},
+		{"Budi", "an", "Budi", false},
+		// The text is escaped, the markers are not.
+		{"<b>Ana</b>", "ana", "&lt;b&gt;<mark>Ana</mark>&lt;/b&gt;", true},
+		{"Tom & Jerry", "&", "Tom <mark>&amp;</mark> Jerry", true},
+		{`O'Brien "Ann"`, "ann", "O&#39;Brien &#34;<mark>Ann</mark>&#34;", true},
+	}
+
+	for _, tt := range tests {
+		got, found := markMatches(tt.s, tt.q, "<mark>", "</mark>")
+		if got != tt.want || found != tt.wantFound {
+			t.Errorf("markMatches(%q, %q) = %q, %v, want %q, %v", tt.s, tt.q, got, found, tt.want, tt.wantFound)
+		}
+	}
+}
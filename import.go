@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultImportChunkSize = 500
+const maxImportChunkSize = 10000
+
+var errInvalidCSV = errors.New("invalid CSV")
+
+// utf8BOM is the byte order mark spreadsheet programs put at the start of
+// UTF-8 CSV files and look for when opening one.
+const utf8BOM = "\ufeff"
+
+var studentCSVColumns = []string{"nim", "name", "age", "address"}
+
+type studentCSVReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// newStudentCSVReader reads the header row of body and returns a reader for
+// the student rows that follow. Columns are matched by name, in any order.
+func newStudentCSVReader(body io.Reader) (*studentCSVReader, error) {
+	r := csv.NewReader(body)
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errEmptyBody
+		}
+		return nil, fmt.Errorf("%w: %w", errInvalidCSV, err)
+	}
+
+	// A file saved by Excel as UTF-8 starts with a byte order mark, which
+	// would otherwise become part of the first column name.
+	header[0] = strings.TrimPrefix(header[0], utf8BOM)
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range studentCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", errInvalidCSV, name)
+		}
+	}
+	r.FieldsPerRecord = len(header)
+
+	return &studentCSVReader{r: r, columns: columns}, nil
+}
+
+// Next returns the next student, or io.EOF when there are no more rows.
+func (c *studentCSVReader) Next() (Student, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Student{}, io.EOF
+		}
+		return Student{}, fmt.Errorf("%w: %w", errInvalidCSV, err)
+	}
+
+	line, _ := c.r.FieldPos(0)
+	age, err := strconv.ParseUint(strings.TrimSpace(record[c.columns["age"]]), 10, 16)
+	if err != nil {
+		return Student{}, fmt.Errorf("%w: line %d: invalid age %q", errInvalidCSV, line, record[c.columns["age"]])
+	}
+
+	return Student{
+		NIM:     record[c.columns["nim"]],
+		Name:    record[c.columns["name"]],
+		Age:     uint16(age),
+		Address: record[c.columns["address"]],
+	}, nil
+}
+
+type importResult struct {
+	Imported    int    `json:"imported"`
+	Chunks      int    `json:"chunks"`
+	FailedChunk int    `json:"failed_chunk,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// importCSV saves the students in body in chunks of chunkSize rows, each
+// chunk in its own transaction. Chunks committed before a failure stay
+// committed; the returned result tells how far the import got. progress, if
+// not nil, is called after every committed chunk. defaults, if not nil, is
+// applied to every row before it is checked with validate and saved. A row
+// failing validation stops the import with an error wrapping
+// ValidationErrors, and so does the cancellation of ds's context, e.g. by a
+// client going away.
+func importCSV(ds *Datastore, body io.Reader, chunkSize int, defaults func(*Student), validate func(Student) error, progress func(importResult)) (importResult, error) {
+	var result importResult
+
+	reader, err := newStudentCSVReader(body)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	chunk := make([]Student, 0, chunkSize)
+	flush := func() error {
+		if err := ds.SaveBatch(chunk); err != nil {
+			return err
+		}
+		result.Imported += len(chunk)
+		result.Chunks++
+		chunk = chunk[:0]
+		if progress != nil {
+			progress(result)
+		}
+		return nil
+	}
+
+	for row := 1; ; row++ {
+		if err := ds.context().Err(); err != nil {
+			result.FailedChunk = result.Chunks + 1
+			result.Error = err.Error()
+			return result, err
+		}
+
+		student, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err == nil {
+			if defaults != nil {
+				defaults(&student)
+			}
+			err = validate(student)
+			if err != nil {
+				err = fmt.Errorf("row %d: %w", row, err)
+			}
+		}
+		if err == nil {
+			chunk = append(chunk, student)
+			if len(chunk) < chunkSize {
+				continue
+			}
+			err = flush()
+		}
+		if err != nil {
+			result.FailedChunk = result.Chunks + 1
+			result.Error = err.Error()
+			return result, err
+		}
+	}
+
+	if len(chunk) > 0 {
+		if err := flush(); err != nil {
+			result.FailedChunk = result.Chunks + 1
+			result.Error = err.Error()
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func parseChunkSize(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("chunk_size")
+	if v == "" {
+		return defaultImportChunkSize, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxImportChunkSize {
+		return 0, fmt.Errorf("chunk_size must be between 1 and %d", maxImportChunkSize)
+	}
+	return n, nil
+}
+
+func (h *handler) importStudents(w http.ResponseWriter, r *http.Request) {
+	chunkSize, err := parseChunkSize(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	async, err := parseFlag(r, "async")
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if async {
+		h.startImportJob(w, r, chunkSize)
+		return
+	}
+
+	if negotiate(r, "application/json", eventStreamMediaType) == eventStreamMediaType {
+		h.streamImport(w, r, chunkSize)
+		return
+	}
+
+	result, err := importCSV(h.store(r), r.Body, chunkSize, h.applyDefaults, h.validate, func(p importResult) {
+		h.cache.invalidate()
+		log.Printf("import: committed chunk %d, %d rows so far", p.Chunks, p.Imported)
+	})
+	if isContextError(err) {
+		log.Printf("import: client went away, stopped after %d committed rows", result.Imported)
+		return
+	}
+	if err != nil {
+		respondJSON(w, r, importErrorStatus(err), result)
+		return
+	}
+
+	respondJSON(w, r, http.StatusCreated, result)
+}
+
+// readImportBody reads the body of an import that is held in memory,
+// answering 413 when it is larger than MAX_IMPORT_BODY_BYTES. It writes the
+// error response and returns false when the import must not proceed.
+func (h *handler) readImportBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.cfg.MaxImportBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("import body exceeds maximum of %d bytes", tooLarge.Limit))
+		return nil, false
+	}
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return body, true
+}
+
+// importErrorStatus maps an error returned by importCSV to a status.
+func importErrorStatus(err error) int {
+	var verrs ValidationErrors
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errEmptyBody), errors.Is(err, errInvalidCSV):
+		return http.StatusBadRequest
+	case errors.As(err, &verrs):
+		return http.StatusUnprocessableEntity
+	case isConstraintError(err):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+const eventStreamMediaType = "text/event-stream"
+
+type importProgress struct {
+	Processed int `json:"processed"`
+	Total     int `json:"total"`
+}
+
+// streamImport runs an import for a client accepting text/event-stream and
+// reports on it with server-sent events: a progress event after every
+// committed chunk, then a done event carrying the result, or an error event
+// carrying the result and the status the import would have had. To know the
+// total up front the body is read into memory and counted first; a body that
+// is not valid CSV is still answered with a plain 400.
+func (h *handler) streamImport(w http.ResponseWriter, r *http.Request, chunkSize int) {
+	body, ok := h.readImportBody(w, r)
+	if !ok {
+		return
+	}
+	total, err := countCSVRows(body)
+	if err != nil {
+		respondJSON(w, r, importErrorStatus(err), importResult{Error: err.Error()})
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	send := func(event string, data any) {
+		b, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("Content-Type", eventStreamMediaType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send("progress", importProgress{Processed: 0, Total: total})
+
+	result, err := importCSV(h.store(r), bytes.NewReader(body), chunkSize, h.applyDefaults, h.validate, func(p importResult) {
+		h.cache.invalidate()
+		send("progress", importProgress{Processed: p.Imported, Total: total})
+	})
+	if isContextError(err) {
+		log.Printf("import: client went away, stopped after %d of %d rows committed", result.Imported, total)
+		return
+	}
+	if err != nil {
+		send("error", struct {
+			importResult
+			Status int `json:"status"`
+		}{result, importErrorStatus(err)})
+		return
+	}
+	send("done", result)
+}
+
+// countCSVRows counts the student rows of a CSV import without checking
+// their values.
+func countCSVRows(body []byte) (int, error) {
+	reader, err := newStudentCSVReader(bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	rows := 0
+	for {
+		_, err := reader.r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", errInvalidCSV, err)
+		}
+		rows++
+	}
+}
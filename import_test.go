@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// unicodeStudents have names and addresses that CSV and JSON must carry
+// unchanged.
+var unicodeStudents = []Student{
+	{NIM: "1301", Name: "Zoë Ñúñez", Age: 20, Address: "Jl. Cikini Raya, Menteng"},
+	{NIM: "1302", Name: "Siti 'Ani' O'Brien", Age: 21, Address: `Gang "Mawar" 5`},
+	{NIM: "1303", Name: "山田 太郎", Age: 22, Address: "東京都"},
+	{NIM: "1304", Name: "Dewi 🌸 Lestari", Age: 23, Address: "Jl. Merdeka\nBlok C"},
+	{NIM: "1305", Name: "Александр Ḳhan", Age: 24, Address: "ถนนสุขุมวิท"},
+}
+
+// exportedStudents reads the students of a CSV export keyed by NIM.
+func exportedStudents(t *testing.T, body string) map[string][]string {
+	t.Helper()
+
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	students := map[string][]string{}
+	for _, rec := range records[1:] {
+		students[rec[0]] = rec
+	}
+	return students
+}
+
+func TestUnicodeRoundTrip(t *testing.T) {
+	h, ds := newTestRouter(t)
+	for _, s := range unicodeStudents {
+		body, _ := json.Marshal(s)
+		if rec := serve(h, http.MethodPost, "/students", string(body)); rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d: %s", s.NIM, rec.Code, rec.Body)
+		}
+	}
+
+	for _, want := range unicodeStudents {
+		rec := serve(h, http.MethodGet, "/students/"+want.NIM, "")
+		var got Student
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		if got.Name != want.Name || got.Address != want.Address {
+			t.Errorf("JSON of %s: %q at %q, want %q at %q", want.NIM, got.Name, got.Address, want.Name, want.Address)
+		}
+	}
+
+	export := serve(h, http.MethodGet, "/students.csv", "").Body.String()
+	exported := exportedStudents(t, export)
+	for _, want := range unicodeStudents {
+		if got := exported[want.NIM]; got == nil || got[1] != want.Name || got[3] != want.Address {
+			t.Errorf("CSV of %s: %q, want %q at %q", want.NIM, got, want.Name, want.Address)
+		}
+	}
+	// Fields with commas, quotes or line breaks must be quoted.
+	for _, quoted := range []string{`"Jl. Cikini Raya, Menteng"`, `"Gang ""Mawar"" 5"`, "\"Jl. Merdeka\nBlok C\""} {
+		if !strings.Contains(export, quoted) {
+			t.Errorf("export does not contain %s:\n%s", quoted, export)
+		}
+	}
+
+	// The export imports again unchanged.
+	for _, s := range unicodeStudents {
+		serve(h, http.MethodDelete, "/students/"+s.NIM, "")
+	}
+	if rec := serve(h, http.MethodPost, "/students/import", export); rec.Code != http.StatusCreated {
+		t.Fatalf("re-import: status %d: %s", rec.Code, rec.Body)
+	}
+	for _, want := range unicodeStudents {
+		got, err := ds.FindByNIM(want.NIM)
+		if err != nil || got.Name != want.Name || got.Address != want.Address {
+			t.Errorf("re-imported %s: %+v, %v, want %q at %q", want.NIM, got, err, want.Name, want.Address)
+		}
+	}
+}
+
+func TestImportBOM(t *testing.T) {
+	h, ds := newTestRouter(t)
+
+	body := utf8BOM + "nim,name,age,address\n1301,Zoë,20,Bandung\n"
+	if rec := serve(h, http.MethodPost, "/students/import", body); rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got, err := ds.FindByNIM("1301"); err != nil || got.Name != "Zoë" {
+		t.Errorf("imported %+v, %v, want Zoë", got, err)
+	}
+}
+
+func TestExportBOM(t *testing.T) {
+	h, ds := newTestRouter(t)
+	addStudents(t, ds, unicodeStudents[0])
+
+	tests := []struct {
+		query   string
+		wantBOM bool
+	}{
+		{"", false},
+		{"?bom=false", false},
+		{"?bom=true", true},
+		{"?bom", true},
+	}
+	for _, tt := range tests {
+		rec := serve(h, http.MethodGet, "/students.csv"+tt.query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tt.query, rec.Code, rec.Body)
+		}
+		body := rec.Body.String()
+		if hasBOM := strings.HasPrefix(body, utf8BOM); hasBOM != tt.wantBOM {
+			t.Errorf("%s: byte order mark %v, want %v", tt.query, hasBOM, tt.wantBOM)
+		}
+		if got := exportNIMs(t, strings.TrimPrefix(body, utf8BOM)); len(got) != 1 {
+			t.Errorf("%s: exported %v, want one student", tt.query, got)
+		}
+	}
+
+	if rec := serve(h, http.MethodGet, "/students.csv?bom=maybe", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("bom=maybe: status %d, want 400", rec.Code)
+	}
+}
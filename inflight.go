@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inflightTracker keeps count of the requests being served, so that the
+// shutdown drain can report on them.
+type inflightTracker struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]string
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{requests: map[uint64]string{}}
+}
+
+func (t *inflightTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.mu.Lock()
+		t.next++
+		id := t.next
+		t.requests[id] = r.Method + " " + r.URL.Path
+		t.mu.Unlock()
+
+		defer func() {
+			t.mu.Lock()
+			delete(t.requests, id)
+			t.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Active returns the number of requests in flight.
+func (t *inflightTracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.requests)
+}
+
+// Requests returns the method and path of every request in flight, sorted.
+func (t *inflightTracker) Requests() []string {
+	t.mu.Lock()
+	reqs := make([]string, 0, len(t.requests))
+	for _, req := range t.requests {
+		reqs = append(reqs, req)
+	}
+	t.mu.Unlock()
+
+	sort.Strings(reqs)
+	return reqs
+}
+
+// logDrain logs the number of requests still in flight every interval
+// until done is closed.
+func (t *inflightTracker) logDrain(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			log.Printf("shutdown: draining, %d requests in flight", t.Active())
+		}
+	}
+}
+
+func (t *inflightTracker) writeMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP http_requests_in_flight Requests currently being served.")
+	fmt.Fprintln(w, "# TYPE http_requests_in_flight gauge")
+	fmt.Fprintf(w, "http_requests_in_flight %d\n", t.Active())
+}
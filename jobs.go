@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	jobPending = "pending"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+const createJobsTable = `CREATE TABLE IF NOT EXISTS jobs (id TEXT NOT NULL PRIMARY KEY, school_id TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL, total INTEGER NOT NULL, imported INTEGER NOT NULL DEFAULT 0, chunks INTEGER NOT NULL DEFAULT 0,
+	failed_chunk INTEGER NOT NULL DEFAULT 0, error TEXT NOT NULL DEFAULT '', created_at TEXT NOT NULL, updated_at TEXT NOT NULL)`
+
+const jobColumns = "id, status, total, imported, chunks, failed_chunk, error, created_at, updated_at"
+
+// importJob is an import running in the background, as reported by
+// GET /jobs/{id}.
+type importJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Total  int    `json:"total"`
+	importResult
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var errJobNotFound = errors.New("job not found")
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateJob stores a new pending job of the datastore's school.
+func (ds *Datastore) CreateJob(job importJob) error {
+	return retrySchema(ds, func() error {
+		now := formatTimestamp(time.Now())
+		_, err := ds.conn().Exec("INSERT INTO jobs (id, school_id, status, total, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			job.ID, ds.school, job.Status, job.Total, now, now)
+		return err
+	})
+}
+
+// UpdateJob stores the status and progress of job.
+func (ds *Datastore) UpdateJob(job importJob) error {
+	return retrySchema(ds, func() error {
+		_, err := ds.conn().Exec("UPDATE jobs SET status = ?, imported = ?, chunks = ?, failed_chunk = ?, error = ?, updated_at = ? WHERE id = ? AND school_id = ?",
+			job.Status, job.Imported, job.Chunks, job.FailedChunk, job.Error, formatTimestamp(time.Now()), job.ID, ds.school)
+		return err
+	})
+}
+
+// FindJob returns the job of the datastore's school with the given ID.
+func (ds *Datastore) FindJob(id string) (importJob, error) {
+	return withSchemaRetry(ds, func() (importJob, error) {
+		var job importJob
+		var createdAt, updatedAt string
+		err := ds.conn().QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ? AND school_id = ?", id, ds.school).
+			Scan(&job.ID, &job.Status, &job.Total, &job.Imported, &job.Chunks, &job.FailedChunk, &job.Error, &createdAt, &updatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return importJob{}, errJobNotFound
+		}
+		if err != nil {
+			return importJob{}, err
+		}
+		job.CreatedAt, _ = time.Parse(timestampLayout, createdAt)
+		job.UpdatedAt, _ = time.Parse(timestampLayout, updatedAt)
+		return job, nil
+	})
+}
+
+// FailInterruptedJobs marks the jobs of every school that were pending or
+// running when the process stopped as failed, since nothing will finish
+// them. The rows they committed stay committed.
+func (ds *Datastore) FailInterruptedJobs() (int64, error) {
+	return withSchemaRetry(ds, func() (int64, error) {
+		res, err := ds.conn().Exec("UPDATE jobs SET status = ?, failed_chunk = chunks + 1, error = ?, updated_at = ? WHERE status IN (?, ?)",
+			jobFailed, "interrupted by a restart", formatTimestamp(time.Now()), jobPending, jobRunning)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	})
+}
+
+// jobRunner runs import jobs in the background. Their context is cancelled
+// when shutdown gives up waiting for them, so they stop at the next query
+// instead of being killed halfway through a chunk.
+type jobRunner struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newJobRunner() *jobRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobRunner{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in the background with the context of the runner.
+func (j *jobRunner) Go(fn func(ctx context.Context)) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		fn(j.ctx)
+	}()
+}
+
+// Shutdown waits for the running jobs to finish until ctx is done, then
+// cancels the rest and waits for them to stop. It returns ctx's error when
+// jobs had to be cancelled.
+func (j *jobRunner) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		j.cancel()
+		return nil
+	case <-ctx.Done():
+		j.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// startImportJob accepts an import to run in the background and answers 202
+// with the job to poll at once. The body is read into memory first, up to
+// MAX_IMPORT_BODY_BYTES, both to outlive the request and to reject a
+// malformed one with a plain 400.
+func (h *handler) startImportJob(w http.ResponseWriter, r *http.Request, chunkSize int) {
+	body, ok := h.readImportBody(w, r)
+	if !ok {
+		return
+	}
+	total, err := countCSVRows(body)
+	if err != nil {
+		respondJSON(w, r, importErrorStatus(err), importResult{Error: err.Error()})
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	job := importJob{ID: id, Status: jobPending, Total: total}
+
+	// The job outlives the request, so it must not share its context.
+	ds := h.datastore.WithContext(context.Background()).ForSchool(schoolFromContext(r.Context()))
+	if err := ds.CreateJob(job); err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+	h.jobs.Go(func(ctx context.Context) {
+		runImportJob(ctx, ds, job, body, chunkSize, h.applyDefaults, h.validate, h.cache)
+	})
+
+	stored, err := ds.FindJob(id)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/students/import")+"/jobs/"+id)
+	respondJSON(w, r, http.StatusAccepted, stored)
+}
+
+// runImportJob runs an import accepted by startImportJob until ctx is done,
+// storing its progress and clearing cache after every committed chunk. The
+// status is stored through ds, so a cancelled job is still recorded as
+// failed.
+func runImportJob(ctx context.Context, ds *Datastore, job importJob, body []byte, chunkSize int, defaults func(*Student), validate func(Student) error, cache *ttlCache) {
+	save := func() {
+		if err := ds.UpdateJob(job); err != nil {
+			log.Printf("import job %s: storing status %s: %v", job.ID, job.Status, err)
+		}
+	}
+
+	job.Status = jobRunning
+	save()
+
+	result, err := importCSV(ds.WithContext(ctx), bytes.NewReader(body), chunkSize, defaults, validate, func(p importResult) {
+		job.importResult = p
+		cache.invalidate()
+		save()
+	})
+	job.importResult = result
+	job.Status = jobDone
+	if err != nil {
+		job.Status = jobFailed
+		log.Printf("import job %s: failed after %d rows: %v", job.ID, result.Imported, err)
+	} else {
+		log.Printf("import job %s: imported %d rows", job.ID, result.Imported)
+	}
+	save()
+}
+
+func (h *handler) getJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store(r).FindJob(chi.URLParam(r, "id"))
+	if errors.Is(err, errJobNotFound) {
+		respondError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, job)
+}
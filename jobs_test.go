@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importCSVBody returns a CSV of n valid students.
+func importCSVBody(n int) string {
+	var b strings.Builder
+	b.WriteString("nim,name,age,address\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%06d,Ana,20,Bandung\n", i)
+	}
+	return b.String()
+}
+
+// waitForJob polls the job at location, with the extra header pairs, until
+// it is no longer pending or running.
+func waitForJob(t *testing.T, h http.Handler, location string, header ...string) importJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := serve(h, http.MethodGet, location, "", header...)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("poll %s: status %d: %s", location, rec.Code, rec.Body)
+		}
+		var job importJob
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatalf("decode job %s: %v", rec.Body, err)
+		}
+		if job.Status != jobPending && job.Status != jobRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s after 5s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestImportJob(t *testing.T) {
+	h, ds := newTestRouter(t)
+
+	rec := serve(h, http.MethodPost, "/students/import?async=true&chunk_size=100", importCSVBody(250))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", rec.Code, rec.Body)
+	}
+	var accepted importJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	location := rec.Header().Get("Location")
+	if location != "/jobs/"+accepted.ID || accepted.Total != 250 {
+		t.Fatalf("accepted %s at %q, want a job of 250 rows at /jobs/{id}", rec.Body, location)
+	}
+
+	job := waitForJob(t, h, location)
+	if job.Status != jobDone || job.Imported != 250 || job.Chunks != 3 {
+		t.Errorf("job %+v, want done with 250 rows in 3 chunks", job)
+	}
+	if n := countStudents(t, ds); n != 250 {
+		t.Errorf("%d students stored, want 250", n)
+	}
+}
+
+func TestImportJobFailedChunk(t *testing.T) {
+	h, ds := newTestRouter(t)
+
+	body := importCSVBody(150) + "999999,Ana,3,Bandung\n"
+	rec := serve(h, http.MethodPost, "/students/import?async&chunk_size=100", body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", rec.Code, rec.Body)
+	}
+
+	job := waitForJob(t, h, rec.Header().Get("Location"))
+	if job.Status != jobFailed || job.Imported != 100 || job.FailedChunk != 2 || job.Error == "" {
+		t.Errorf("job %+v, want failed in chunk 2 after 100 rows", job)
+	}
+	if n := countStudents(t, ds); n != 100 {
+		t.Errorf("%d students stored, want the 100 of the first chunk", n)
+	}
+}
+
+func TestImportJobRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"bad async", "/students/import?async=maybe", importCSVBody(1), http.StatusBadRequest},
+		{"bad header", "/students/import?async=true", "nim,name\n1301,Ana\n", http.StatusBadRequest},
+	}
+
+	h, _ := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodPost, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestJobScopedToSchool(t *testing.T) {
+	h, _ := newTestRouter(t)
+
+	rec := serve(h, http.MethodPost, "/students/import?async=true", importCSVBody(1), schoolHeader, "school-a")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+
+	if rec := serve(h, http.MethodGet, location, "", schoolHeader, "school-b"); rec.Code != http.StatusNotFound {
+		t.Errorf("other school: status %d, want 404", rec.Code)
+	}
+	if rec := serve(h, http.MethodGet, "/jobs/unknown", "", schoolHeader, "school-a"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", rec.Code)
+	}
+	waitForJob(t, h, location, schoolHeader, "school-a")
+}
+
+func TestFailInterruptedJobs(t *testing.T) {
+	ds := newTestDatastore(t)
+	for _, job := range []importJob{
+		{ID: "pending", Status: jobPending, Total: 10},
+		{ID: "running", Status: jobRunning, Total: 10},
+		{ID: "done", Status: jobDone, Total: 10},
+	} {
+		if err := ds.CreateJob(job); err != nil {
+			t.Fatalf("create job %s: %v", job.ID, err)
+		}
+	}
+
+	n, err := ds.FailInterruptedJobs()
+	if err != nil || n != 2 {
+		t.Fatalf("FailInterruptedJobs = %d, %v, want 2", n, err)
+	}
+	for id, want := range map[string]string{"pending": jobFailed, "running": jobFailed, "done": jobDone} {
+		job, err := ds.FindJob(id)
+		if err != nil || job.Status != want {
+			t.Errorf("job %s: %+v, %v, want %s", id, job, err, want)
+		}
+	}
+}
+
+func TestImportJobBodyTooLarge(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxImportBody = 64
+	h, ds := newTestRouter(t, WithConfig(cfg))
+
+	rec := serve(h, http.MethodPost, "/students/import?async=true", importCSVBody(10))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413: %s", rec.Code, rec.Body)
+	}
+	if n := countStudents(t, ds); n != 0 {
+		t.Fatalf("%d students imported, want none", n)
+	}
+}
+
+func TestJobRunnerShutdown(t *testing.T) {
+	t.Run("finished", func(t *testing.T) {
+		j := newJobRunner()
+		done := false
+		j.Go(func(ctx context.Context) {
+			time.Sleep(10 * time.Millisecond)
+			done = true
+		})
+		if err := j.Shutdown(context.Background()); err != nil || !done {
+			t.Fatalf("Shutdown = %v, job done %v; want nil after the job finished", err, done)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		j := newJobRunner()
+		var jobErr error
+		j.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			jobErr = ctx.Err()
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := j.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if !errors.Is(jobErr, context.Canceled) {
+			t.Fatalf("job saw %v, want its context cancelled", jobErr)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// wantsJSONAPI reports whether the client prefers JSON:API documents over
+// plain JSON.
+func wantsJSONAPI(r *http.Request) bool {
+	return negotiate(r, jsonMediaTypes...) == jsonAPIMediaType
+}
+
+type jsonAPIResource struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Attributes map[string]any `json:"attributes"`
+	Meta       map[string]any `json:"meta,omitempty"`
+}
+
+type jsonAPIError struct {
+	Status string              `json:"status"`
+	Title  string              `json:"title"`
+	Detail string              `json:"detail,omitempty"`
+	Source *jsonAPIErrorSource `json:"source,omitempty"`
+}
+
+type jsonAPIErrorSource struct {
+	Pointer string `json:"pointer"`
+}
+
+func (v studentView) resource() jsonAPIResource {
+	attrs := v.attributes()
+	delete(attrs, "nim")
+	res := jsonAPIResource{Type: studentResource, ID: v.student.NIM, Attributes: attrs}
+	// Highlights describe the search and embeds are derived from other
+	// students; neither is an attribute of the student.
+	for _, key := range []string{"highlight", "embedded"} {
+		if v, ok := attrs[key]; ok {
+			delete(attrs, key)
+			if res.Meta == nil {
+				res.Meta = map[string]any{}
+			}
+			res.Meta[key] = v
+		}
+	}
+	return res
+}
+
+// toJSONAPI converts a response value into a JSON:API document. Students
+// become resource objects, errors become an errors array and anything else
+// is returned as top-level meta.
+func toJSONAPI(r *http.Request, status int, v any) any {
+	switch v := v.(type) {
+	case studentView:
+		return map[string]any{"data": v.resource()}
+	case []studentView:
+		return map[string]any{"data": resources(v)}
+	case listResponse:
+		data := resources(v.Data)
+		// JSON:API puts pagination links at the top level, not in meta.
+		links := v.Meta.Links
+		v.Meta.Links = nil
+		return map[string]any{
+			"data":  data,
+			"meta":  v.Meta,
+			"links": links,
+		}
+	case errorResponse:
+		return map[string]any{"errors": jsonAPIErrors(status, v)}
+	default:
+		return map[string]any{"meta": v}
+	}
+}
+
+func resources(views []studentView) []jsonAPIResource {
+	data := make([]jsonAPIResource, len(views))
+	for i, view := range views {
+		data[i] = view.resource()
+	}
+	return data
+}
+
+func jsonAPIErrors(status int, e errorResponse) []jsonAPIError {
+	code := strconv.Itoa(status)
+	if len(e.Fields) == 0 {
+		return []jsonAPIError{{Status: code, Title: http.StatusText(status), Detail: e.Error}}
+	}
+
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	errs := make([]jsonAPIError, 0, len(fields))
+	for _, field := range fields {
+		pointer := "/data/attributes/" + field
+		if field == "nim" {
+			pointer = "/data/id"
+		}
+		errs = append(errs, jsonAPIError{
+			Status: code,
+			Title:  e.Error,
+			Detail: field + " " + e.Fields[field],
+			Source: &jsonAPIErrorSource{Pointer: pointer},
+		})
+	}
+	return errs
+}
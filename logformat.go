@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// levelCritical is the level of alerts an operator has to act on, such as a
+// database that cannot be written. slog has nothing above ERROR.
+const levelCritical = slog.LevelError + 4
+
+// logLevels are the level words lines of the standard logger start with,
+// such as "WARN slow query ..."; lines without one are INFO.
+var logLevels = []struct {
+	name  string
+	level slog.Level
+}{
+	{"CRITICAL", levelCritical},
+	{"ERROR", slog.LevelError},
+	{"WARN", slog.LevelWarn},
+	{"INFO", slog.LevelInfo},
+	{"DEBUG", slog.LevelDebug},
+}
+
+// levelColors are the ANSI colors of the levels in text logs on a terminal.
+var levelColors = map[string]string{
+	"CRITICAL": "\033[1;31m",
+	"ERROR":    "\033[31m",
+	"WARN":     "\033[33m",
+}
+
+// setupLogging makes the slog handler for format, writing to w, the default
+// logger: slog's JSONHandler, or its TextHandler with the level colored when
+// w is a terminal. The standard logger, which most of the service logs
+// through, goes to the same handler at the level its lines start with.
+// DEBUG records are only kept when debug is set.
+func setupLogging(format string, w io.Writer, debug bool) {
+	h := newLogHandler(format, w, format == logFormatText && isTerminal(w), debug)
+	logger := slog.New(h)
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(&levelWriter{logger: logger})
+}
+
+func newLogHandler(format string, w io.Writer, color, debug bool) slog.Handler {
+	opts := &slog.HandlerOptions{ReplaceAttr: nameCritical}
+	if debug {
+		opts.Level = slog.LevelDebug
+	}
+	if format == logFormatText {
+		if color {
+			w = &colorLevelWriter{out: w}
+		}
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// nameCritical names levelCritical CRITICAL instead of slog's ERROR+4.
+func nameCritical(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == levelCritical {
+			a.Value = slog.StringValue("CRITICAL")
+		}
+	}
+	return a
+}
+
+// isTerminal reports whether w is a terminal rather than a file or a pipe.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// splitLevel splits the level word off a log line.
+func splitLevel(line string) (slog.Level, string) {
+	for _, l := range logLevels {
+		if rest, ok := strings.CutPrefix(line, l.name+" "); ok {
+			return l.level, rest
+		}
+	}
+	return slog.LevelInfo, line
+}
+
+// levelWriter passes the lines of the standard logger, which calls Write
+// once per line, to a slog logger.
+type levelWriter struct {
+	logger *slog.Logger
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	level, msg := splitLevel(strings.TrimSuffix(string(p), "\n"))
+	w.logger.Log(context.Background(), level, msg)
+	return len(p), nil
+}
+
+// colorLevelWriter colors the level of the lines written by a TextHandler.
+type colorLevelWriter struct {
+	out io.Writer
+}
+
+func (w *colorLevelWriter) Write(p []byte) (int, error) {
+	for level, color := range levelColors {
+		attr := []byte(" level=" + level + " ")
+		if i := bytes.Index(p, attr); i >= 0 {
+			value := i + len(" level=")
+			colored := make([]byte, 0, len(p)+len(color)+4)
+			colored = append(colored, p[:value]...)
+			colored = append(colored, color+level+"\033[0m"...)
+			colored = append(colored, p[value+len(level):]...)
+			if _, err := w.out.Write(colored); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+	return w.out.Write(p)
+}
+
+// requestLogger logs every request through slog with its method, path,
+// status, size and duration as attributes of their own, so they can be
+// queried without parsing the message.
+func requestLogger() func(next http.Handler) http.Handler {
+	return middleware.RequestLogger(slogRequestFormatter{})
+}
+
+type slogRequestFormatter struct{}
+
+func (slogRequestFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	return &slogRequestEntry{
+		attrs: []slog.Attr{
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.RequestURI()),
+			slog.String("remote", r.RemoteAddr),
+		},
+	}
+}
+
+type slogRequestEntry struct {
+	attrs []slog.Attr
+}
+
+func (e *slogRequestEntry) Write(status, bytes int, header http.Header, elapsed time.Duration, extra interface{}) {
+	slog.LogAttrs(context.Background(), slog.LevelInfo, "request", append(e.attrs,
+		slog.Int("status", status),
+		slog.Int("bytes", bytes),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	)...)
+}
+
+func (e *slogRequestEntry) Panic(v interface{}, stack []byte) {
+	slog.LogAttrs(context.Background(), slog.LevelError, "panic", append(e.attrs,
+		slog.String("panic", fmt.Sprint(v)),
+		slog.String("stack", string(stack)),
+	)...)
+}
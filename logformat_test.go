@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// captureLogs sets logging up in format, writing to the returned buffer,
+// until the test ends.
+func captureLogs(t *testing.T, format string, debug bool) *bytes.Buffer {
+	t.Helper()
+
+	prev, prevOut, prevFlags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	})
+
+	var buf bytes.Buffer
+	setupLogging(format, &buf, debug)
+	return &buf
+}
+
+// logSomething logs through the standard logger, through slog and through
+// the request logger.
+func logSomething() {
+	log.Printf("WARN slow query took %dms", 12)
+	log.Print("CRITICAL database is read-only")
+	slog.Debug("route", "pattern", "/students")
+	h := requestLogger()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	serve(h, http.MethodPost, "/students", studentJSON("1301"))
+}
+
+func TestLogFormatJSON(t *testing.T) {
+	buf := captureLogs(t, logFormatJSON, false)
+	logSomething()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3 without the DEBUG one:\n%s", len(records), buf)
+	}
+
+	if records[0]["level"] != "WARN" || records[0]["msg"] != "slow query took 12ms" {
+		t.Errorf("standard logger line logged as %v", records[0])
+	}
+	if records[1]["level"] != "CRITICAL" {
+		t.Errorf("critical line logged as %v", records[1])
+	}
+	req := records[2]
+	if req["msg"] != "request" || req["method"] != "POST" || req["path"] != "/students" || req["status"] != float64(http.StatusCreated) {
+		t.Errorf("request logged as %v", req)
+	}
+	if _, ok := req["duration_ms"].(float64); !ok {
+		t.Errorf("request logged without a numeric duration_ms: %v", req)
+	}
+}
+
+func TestLogFormatText(t *testing.T) {
+	buf := captureLogs(t, logFormatText, false)
+	logSomething()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3 without the DEBUG one:\n%s", len(lines), buf)
+	}
+	for _, line := range lines {
+		if json.Valid([]byte(line)) {
+			t.Errorf("text log line %q is JSON", line)
+		}
+		if strings.Contains(line, "\033[") {
+			t.Errorf("line %q is colored, but the output is not a terminal", line)
+		}
+	}
+	for i, want := range []string{
+		`level=WARN msg="slow query took 12ms"`,
+		`level=CRITICAL msg="database is read-only"`,
+		`level=INFO msg=request request_id="" method=POST path=/students`,
+	} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("line %q does not contain %q", lines[i], want)
+		}
+	}
+	if !strings.Contains(lines[2], " status=201 ") {
+		t.Errorf("request line %q has no status", lines[2])
+	}
+}
+
+func TestLogDebug(t *testing.T) {
+	buf := captureLogs(t, logFormatJSON, true)
+	logSomething()
+
+	if !strings.Contains(buf.String(), `"level":"DEBUG","msg":"route","pattern":"/students"`) {
+		t.Errorf("DEBUG record dropped with debug on:\n%s", buf)
+	}
+}
+
+func TestColorLevelWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &colorLevelWriter{out: &buf}
+	w.Write([]byte("time=x level=WARN msg=\"slow\"\n"))
+	w.Write([]byte("time=x level=INFO msg=fine\n"))
+
+	want := "time=x level=\033[33mWARN\033[0m msg=\"slow\"\ntime=x level=INFO msg=fine\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
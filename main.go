@@ -1,194 +1,110 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
-	"errors"
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-type Student struct {
-	NIM     string `json:"nim"`
-	Name    string `json:"name"`
-	Age     uint16 `json:"age"`
-	Address string `json:"address"`
-}
-
-var errDataNotFound = errors.New("data not found")
-var errInternalServer = errors.New("internal server error")
-
-type Datastore struct {
-	// StudentMap map[string]Student
-	StudentSQLite *sql.DB
-}
-
-func (ds *Datastore) Save(student Student) error {
-	stmt, err := ds.StudentSQLite.Prepare("INSERT INTO students(nim, name, age, address) values(?,?,?,?)")
+func main() {
+	cfg, err := loadConfig()
+	setupLogging(cfg.LogFormat, os.Stderr, cfg.Debug)
 	if err != nil {
-		return err
+		log.Fatalf("ERROR %v", err)
 	}
-
-	_, err = stmt.Exec(student.NIM, student.Name, student.Age, student.Address)
-	if err != nil {
-		return err
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("ERROR %v", err)
 	}
 
-	return nil
-}
-
-func (ds *Datastore) DeleteByNIM(nim string) error {
-	sqlStatement := `DELETE FROM students WHERE nim = $1;`
-	_, err := ds.StudentSQLite.Exec(sqlStatement, nim)
-	return err
-}
-
-func (ds *Datastore) UpdateByNIM(student Student) error {
-
-	stmt, _ := ds.StudentSQLite.Prepare("UPDATE students SET name = ?, age = ?, address = ? WHERE nim = ?")
-	defer stmt.Close()
-
-	res, err := stmt.Exec(student.Name, student.Age, student.Address, student.NIM)
-	log.Println(res.RowsAffected())
-	return err
-}
-
-func (ds *Datastore) FindAll() []Student {
-	var students []Student
-	rows, _ := ds.StudentSQLite.Query("SELECT * FROM students")
-	defer rows.Close()
-
-	for rows.Next() {
-		var student Student
-		rows.Scan(&student.NIM, &student.Name, &student.Age, &student.Address)
-		students = append(students, student)
+	shutdownTracing, err := setupTracing(context.Background(), cfg.TracingEndpoint)
+	if err != nil {
+		log.Fatalf("ERROR %v", err)
 	}
+	defer shutdownTracing(context.Background())
 
-	return students
-}
-
-func (ds *Datastore) FindByNIM(nim string) (Student, error) {
-	var student Student
-	sqlStatement := `SELECT nim, name,age,address FROM students WHERE nim=$1;`
-	row := ds.StudentSQLite.QueryRow(sqlStatement, nim)
-	err := row.Scan(&student.NIM, &student.Name, &student.Age, &student.Address)
+	datastore, err := newDatastore(cfg.DBPath, cfg.NIMScope)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return Student{}, errDataNotFound
-		}
-		return Student{}, errInternalServer
+		log.Fatalf("ERROR %v", err)
+	}
+	defer datastore.StudentSQLite.Close()
+	log.Printf("NIM uniqueness scope: %s", cfg.NIMScope)
+	if n, err := datastore.FailInterruptedJobs(); err != nil {
+		log.Printf("ERROR marking interrupted import jobs as failed: %v", err)
+	} else if n > 0 {
+		log.Printf("WARN %d import jobs were interrupted by the restart and are marked failed", n)
 	}
 
-	return student, nil
-}
-
-func main() {
-	r := chi.NewRouter()
-
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-
-	db, err := sql.Open("sqlite3", "./students.db")
-	if err != nil {
-		log.Fatal(err)
+	if cfg.SlowQueryLog {
+		datastore.LogSlowQueries(cfg.SlowQueryThreshold)
+	}
+	datastore.LimitQueries(cfg.QueryTimeout)
+	if cfg.NIMCaseInsensitive {
+		datastore.IgnoreNIMCase()
 	}
-	defer db.Close()
 
-	sqlStmt := `create table if not exists students (nim text not null primary key, name text not null, age INTEGER not null, address TEXT not null);`
-	_, err = db.Exec(sqlStmt)
+	// The pattern was checked with the rest of the configuration.
+	nims, err := newNIMValidator(cfg.NIMPattern)
 	if err != nil {
-		log.Printf("%q: %s\n", err, sqlStmt)
-		return
+		log.Fatalf("ERROR NIM_PATTERN: %v", err)
 	}
 
-	datastore := Datastore{
-		StudentSQLite: db,
+	inflight := newInflightTracker()
+	jobs := newJobRunner()
+	srv := &http.Server{
+		Addr:    ":3030",
+		Handler: newRouter(datastore, WithConfig(cfg), WithInflightTracker(inflight), WithJobRunner(jobs), WithNIMValidator(nims)),
 	}
 
-	r.Post("/students", func(w http.ResponseWriter, r *http.Request) {
-		var student Student
-		err := json.NewDecoder(r.Body).Decode(&student)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		err = datastore.Save(student)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLSCertFile != "" {
+			srv.TLSConfig = tlsConfig(cfg.TLSMinVersion)
+			log.Printf("server start on port :3030 with TLS %s or newer", cfg.TLSMinVersion)
+			serveErr <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
 			return
 		}
+		log.Println("server start on port :3030")
+		serveErr <- srv.ListenAndServe()
+	}()
 
-		w.WriteHeader(http.StatusCreated)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(student.NIM))
-	})
-
-	r.Delete("/students/{nim}", func(w http.ResponseWriter, r *http.Request) {
-		nim := chi.URLParam(r, "nim")
-		err := datastore.DeleteByNIM(nim)
-		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(err.Error()))
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-	})
-
-	r.Put("/students", func(w http.ResponseWriter, r *http.Request) {
-		var student Student
-		err := json.NewDecoder(r.Body).Decode(&student)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		err = datastore.UpdateByNIM(student)
-		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-	})
-
-	r.Get("/students", func(w http.ResponseWriter, r *http.Request) {
-		students := datastore.FindAll()
-		w.WriteHeader(http.StatusOK)
-		studentJSON, _ := json.Marshal(students)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(studentJSON))
-	})
+	select {
+	case err := <-serveErr:
+		log.Println(err)
+		return
+	case <-ctx.Done():
+	}
 
-	r.Get("/students/{nim}", func(w http.ResponseWriter, r *http.Request) {
-		nim := chi.URLParam(r, "nim")
-		student, err := datastore.FindByNIM(nim)
+	log.Printf("shutdown: waiting for %d requests in flight", inflight.Active())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-		if err != nil {
-			if errors.Is(err, errDataNotFound) {
-				w.WriteHeader(http.StatusNotFound)
-				w.Write([]byte(err.Error()))
-				return
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(err.Error()))
-				return
-			}
-		}
+	drained := make(chan struct{})
+	go inflight.logDrain(time.Second, drained)
+	err = srv.Shutdown(shutdownCtx)
+	close(drained)
 
-		studentJSON, _ := json.Marshal(student)
-		w.WriteHeader(http.StatusOK)
-		w.Write(studentJSON)
-	})
+	if err != nil {
+		log.Printf("shutdown: %v with %d requests in flight: %s",
+			err, inflight.Active(), strings.Join(inflight.Requests(), ", "))
+	} else {
+		log.Println("shutdown: all requests drained")
+	}
 
-	log.Println("server start on port :3030")
-	http.ListenAndServe(":3030", r)
+	// Import jobs get what is left of the shutdown timeout; the ones still
+	// running after that are cancelled and recorded as failed.
+	if err := jobs.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WARN shutdown: import jobs cancelled: %v", err)
+		return
+	}
+	log.Println("shutdown: all import jobs finished")
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type routeKey struct {
+	Method string
+	Route  string
+}
+
+// sloMonitor counts requests that take longer than their latency budget.
+// Budgets are looked up by "METHOD /pattern", then by "/pattern", falling
+// back to the default budget.
+type sloMonitor struct {
+	budget time.Duration
+	routes map[string]time.Duration
+
+	mu       sync.Mutex
+	breaches map[routeKey]uint64
+}
+
+func newSLOMonitor(budget time.Duration, routes map[string]time.Duration) *sloMonitor {
+	return &sloMonitor{budget: budget, routes: routes, breaches: map[routeKey]uint64{}}
+}
+
+func (m *sloMonitor) budgetFor(key routeKey) time.Duration {
+	if d, ok := m.routes[key.Method+" "+key.Route]; ok {
+		return d
+	}
+	if d, ok := m.routes[key.Route]; ok {
+		return d
+	}
+	return m.budget
+}
+
+// Middleware times each request and records a breach when it exceeds the
+// budget of the route it matched. Unrouted requests are not tracked, so
+// probing random URLs cannot grow the set of counters.
+func (m *sloMonitor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		elapsed := time.Since(start)
+
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil || rctx.RoutePattern() == "" {
+			return
+		}
+
+		key := routeKey{Method: r.Method, Route: rctx.RoutePattern()}
+		budget := m.budgetFor(key)
+		if budget <= 0 || elapsed <= budget {
+			return
+		}
+
+		m.mu.Lock()
+		m.breaches[key]++
+		m.mu.Unlock()
+
+		log.Printf("WARN SLO breach [%s] %s %s took %s, budget %s",
+			middleware.GetReqID(r.Context()), key.Method, key.Route, elapsed, budget)
+	})
+}
+
+func (m *sloMonitor) writeMetrics(w io.Writer) {
+	m.mu.Lock()
+	counts := make(map[routeKey]uint64, len(m.breaches))
+	keys := make([]routeKey, 0, len(m.breaches))
+	for key, n := range m.breaches {
+		counts[key] = n
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Route != keys[j].Route {
+			return keys[i].Route < keys[j].Route
+		}
+		return keys[i].Method < keys[j].Method
+	})
+
+	fmt.Fprintln(w, "# HELP slo_breaches_total Requests that took longer than the latency budget of their route.")
+	fmt.Fprintln(w, "# TYPE slo_breaches_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "slo_breaches_total{method=\"%s\",route=\"%s\"} %d\n",
+			escapeLabel(key.Method), escapeLabel(key.Route), counts[key])
+	}
+}
+
+type metricsSource interface {
+	writeMetrics(w io.Writer)
+}
+
+// serveMetrics writes the metrics of every source in the Prometheus text
+// exposition format.
+func serveMetrics(sources ...metricsSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, s := range sources {
+			s.writeMetrics(w)
+		}
+	}
+}
+
+// escapeLabel escapes a label value for the text exposition format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(v)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// decompressRequest transparently inflates request bodies sent with
+// Content-Encoding: gzip. The inflated stream is capped at limit bytes to
+// guard against decompression bombs; reading past it fails like any other
+// oversized body.
+func decompressRequest(limit int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				respondError(w, r, http.StatusBadRequest, "invalid gzip body")
+				return
+			}
+			defer zr.Close()
+
+			r.Body = http.MaxBytesReader(w, zr, limit)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// overridableMethods are the methods a POST may be turned into by
+// overrideMethod.
+var overridableMethods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// overrideMethod lets clients behind proxies that only pass GET and POST
+// use the other routes: a POST carrying an X-HTTP-Method-Override header or
+// a ?_method= parameter naming one of overridableMethods is routed as that
+// method. Other methods are never overridden, so a link followed with GET
+// cannot delete anything; naming a method outside the list is a 400.
+func overrideMethod(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("X-HTTP-Method-Override")
+		if method == "" {
+			method = r.URL.Query().Get("_method")
+		}
+		if method == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !containsString(overridableMethods, method) {
+			respondError(w, r, http.StatusBadRequest, fmt.Sprintf("a POST can only be overridden with %s, not %q",
+				strings.Join(overridableMethods, ", "), method))
+			return
+		}
+
+		r.Method = method
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trailingSlashes makes /students/ behave like /students. Safe requests are
+// redirected with 301 to keep URLs canonical; other methods are routed as if
+// the slash were absent, since clients rarely replay a body after a redirect.
+func trailingSlashes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if len(path) <= 1 || !strings.HasSuffix(path, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Collapse leading slashes so the Location can never become a
+		// protocol-relative URL pointing at another host.
+		trimmed := "/" + strings.Trim(path, "/")
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			// The Location is built from the escaped path, so an escaped
+			// slash or '?' in a NIM stays part of the same segment.
+			target := "/" + strings.Trim(r.URL.EscapedPath(), "/")
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			rctx.RoutePath = trimmed
+		} else {
+			r.URL.Path = trimmed
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireJSONShape rejects bodies whose top-level JSON value is not the kind
+// the endpoint expects: '{' for single-student endpoints, '[' for batch ones.
+// Only the first non-whitespace byte is inspected; the handler still sees
+// the whole body. Empty bodies are left to the handler's decoder.
+func requireJSONShape(open byte) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			br := bufio.NewReader(r.Body)
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{br, r.Body}
+
+			first, ok := peekNonSpace(br)
+			if ok && first != open {
+				if open == '[' {
+					respondError(w, r, http.StatusBadRequest, "expected a JSON array of students")
+				} else {
+					respondError(w, r, http.StatusBadRequest, "expected a JSON object")
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// peekNonSpace returns the first non-whitespace byte of br without consuming
+// it. Leading whitespace is consumed.
+func peekNonSpace(br *bufio.Reader) (byte, bool) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			br.Discard(1)
+		default:
+			return b[0], true
+		}
+	}
+}
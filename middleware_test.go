@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrailingSlashes(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"list", http.MethodGet, "/students/", "", http.StatusMovedPermanently, "/students"},
+		{"list keeps the query", http.MethodGet, "/students/?name=ana", "", http.StatusMovedPermanently, "/students?name=ana"},
+		{"single", http.MethodGet, "/students/1301/", "", http.StatusMovedPermanently, "/students/1301"},
+		{"head", http.MethodHead, "/students/1301/", "", http.StatusMovedPermanently, "/students/1301"},
+		{"no other host", http.MethodGet, "//example.com/", "", http.StatusMovedPermanently, "/example.com"},
+		{"escaped slash", http.MethodGet, "/students/13%2F01/", "", http.StatusMovedPermanently, "/students/13%2F01"},
+		{"escaped question mark", http.MethodGet, "/students/13%3F01/?fields=name", "", http.StatusMovedPermanently, "/students/13%3F01?fields=name"},
+		{"escaped query", http.MethodGet, "/students/?name=a%26b&q=%20x", "", http.StatusMovedPermanently, "/students?name=a%26b&q=%20x"},
+		{"escaped leading slashes", http.MethodGet, "/%2F%2Fexample.com/", "", http.StatusMovedPermanently, "/%2F%2Fexample.com"},
+		{"create", http.MethodPost, "/students/", studentJSON("1302"), http.StatusCreated, ""},
+		{"update", http.MethodPut, "/students/", studentJSON("1301"), http.StatusOK, ""},
+		{"delete", http.MethodDelete, "/students/1301/", "", http.StatusOK, ""},
+	}
+
+	h, _ := newTestRouter(t)
+	if rec := serve(h, http.MethodPost, "/students", studentJSON("1301")); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestRequireJSONShape(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"array to create", http.MethodPost, "/students", `[` + studentJSON("1301") + `]`, http.StatusBadRequest, "expected a JSON object"},
+		{"array to update", http.MethodPut, "/students", `[]`, http.StatusBadRequest, "expected a JSON object"},
+		{"array to validate", http.MethodPost, "/students/validate", " \n[]", http.StatusBadRequest, "expected a JSON object"},
+		{"string to create", http.MethodPost, "/students", `"1301"`, http.StatusBadRequest, "expected a JSON object"},
+		{"object to batch", http.MethodPost, "/students/batch", studentJSON("1301"), http.StatusBadRequest, "expected a JSON array of students"},
+		{"number to batch", http.MethodPost, "/students/batch", `1`, http.StatusBadRequest, "expected a JSON array of students"},
+		{"object to create", http.MethodPost, "/students", " " + studentJSON("1301"), http.StatusCreated, ""},
+		{"array to batch", http.MethodPost, "/students/batch", "\t[" + studentJSON("1302") + `]`, http.StatusCreated, ""},
+	}
+
+	h, _ := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			var got errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response %q: %v", rec.Body, err)
+			}
+			if got.Error != tt.wantError {
+				t.Errorf("error %q, want %q", got.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestOverrideMethod(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		header     []string
+		wantStatus int
+		wantMethod string
+	}{
+		{"PUT by header", http.MethodPost, "/", []string{"X-HTTP-Method-Override", "PUT"}, http.StatusOK, http.MethodPut},
+		{"PATCH by header", http.MethodPost, "/", []string{"X-HTTP-Method-Override", "PATCH"}, http.StatusOK, http.MethodPatch},
+		{"DELETE by header", http.MethodPost, "/", []string{"X-HTTP-Method-Override", "DELETE"}, http.StatusOK, http.MethodDelete},
+		{"PUT by parameter", http.MethodPost, "/?_method=PUT", nil, http.StatusOK, http.MethodPut},
+		{"PATCH by parameter", http.MethodPost, "/?_method=patch", nil, http.StatusOK, http.MethodPatch},
+		{"DELETE by parameter", http.MethodPost, "/?_method=DELETE", nil, http.StatusOK, http.MethodDelete},
+		{"header wins", http.MethodPost, "/?_method=DELETE", []string{"X-HTTP-Method-Override", "PUT"}, http.StatusOK, http.MethodPut},
+		{"no override", http.MethodPost, "/", nil, http.StatusOK, http.MethodPost},
+		{"GET not overridable", http.MethodPost, "/", []string{"X-HTTP-Method-Override", "GET"}, http.StatusBadRequest, ""},
+		{"unknown method", http.MethodPost, "/?_method=PURGE", nil, http.StatusBadRequest, ""},
+		{"only POST is overridden", http.MethodGet, "/?_method=DELETE", nil, http.StatusOK, http.MethodGet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := overrideMethod(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r.Method }))
+
+			rec := serve(h, tt.method, tt.target, "", tt.header...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got != tt.wantMethod {
+				t.Errorf("routed as %q, want %q", got, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestOverrideMethodRoutes(t *testing.T) {
+	h, ds := newTestRouter(t)
+	addStudents(t, ds, Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+
+	rec := serve(h, http.MethodPost, "/students/1301", `{"name":"Budi","age":21,"address":"Padang"}`, "X-HTTP-Method-Override", "PUT")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("overridden PUT: status %d: %s", rec.Code, rec.Body)
+	}
+	if s, err := ds.FindByNIM("1301"); err != nil || s.Name != "Budi" {
+		t.Errorf("after overridden PUT: %+v, %v, want Budi", s, err)
+	}
+
+	rec = serve(h, http.MethodPost, "/students/1301?_method=DELETE", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("overridden DELETE: status %d: %s", rec.Code, rec.Body)
+	}
+	if n := countStudents(t, ds); n != 0 {
+		t.Errorf("%d students after overridden DELETE, want 0", n)
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+	name := strings.Repeat("a", 80)
+	student := `{"nim":"1301","name":"` + name + `","age":20,"address":"Bandung"}`
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"within the limit", http.MethodPost, "/students", "application/json", `{"nim":"1301","name":"Ana","age":20,"address":"Bandung"}`, http.StatusCreated},
+		{"create", http.MethodPost, "/students", "application/json", student, http.StatusRequestEntityTooLarge},
+		{"update", http.MethodPut, "/students", "application/json", student, http.StatusRequestEntityTooLarge},
+		{"batch", http.MethodPost, "/students/batch", "application/json", "[" + student + "]", http.StatusRequestEntityTooLarge},
+		{"import", http.MethodPost, "/students/import", "text/csv", importCSVBody(10), http.StatusRequestEntityTooLarge},
+		{"background import", http.MethodPost, "/students/import?async=true", "text/csv", importCSVBody(10), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.MaxDecompressedBody = 100
+			h, _ := newTestRouter(t, WithConfig(cfg))
+
+			var gz bytes.Buffer
+			zw := gzip.NewWriter(&gz)
+			zw.Write([]byte(tt.body))
+			zw.Close()
+			if gz.Len() > 100 {
+				t.Fatalf("compressed body of %d bytes is over the limit itself", gz.Len())
+			}
+
+			req := httptest.NewRequest(tt.method, tt.target, &gz)
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Content-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
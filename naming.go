@@ -0,0 +1,57 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// keyNaming returns the function that renames the keys of a JSON response,
+// or nil to keep the snake_case names from the struct tags. Clients opt in
+// with ?naming=camel or a naming=camel parameter on an Accept media type.
+func keyNaming(r *http.Request) func(string) string {
+	naming := r.URL.Query().Get("naming")
+	if naming == "" {
+		for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+			if _, params, err := mime.ParseMediaType(part); err == nil && params["naming"] != "" {
+				naming = params["naming"]
+				break
+			}
+		}
+	}
+
+	if strings.EqualFold(naming, "camel") {
+		return camelCase
+	}
+	return nil
+}
+
+// camelCase turns a snake_case key such as created_at into createdAt.
+func camelCase(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// renameKeys renames every object key in the decoded document v.
+func renameKeys(v any, rename func(string) string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		renamed := make(map[string]any, len(v))
+		for k, val := range v {
+			renamed[rename(k)] = renameKeys(val, rename)
+		}
+		return renamed
+	case []any:
+		for i, val := range v {
+			v[i] = renameKeys(val, rename)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// jsonMediaTypes are the representations the JSON endpoints can produce, in
+// order of preference.
+var jsonMediaTypes = []string{"application/json", jsonAPIMediaType}
+
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// parseAccept parses an Accept header into media ranges. Ranges that do not
+// parse are skipped; a missing or invalid q counts as 1.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+				q = f
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// quality returns the q the ranges give offer, taken from the most specific
+// range that matches it, and -1 when none does.
+func quality(ranges []mediaRange, offer string) float64 {
+	typ, subtype, _ := strings.Cut(offer, "/")
+	q, specificity := -1.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// negotiate returns the offer the client prefers according to its Accept
+// header, or "" when it accepts none of them. Ties go to the earlier offer,
+// and a request without Accept gets the first.
+func negotiate(r *http.Request, offers ...string) string {
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptable rejects requests with 406 Not Acceptable unless their Accept
+// header allows one of offers.
+func acceptable(offers ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if negotiate(r, offers...) == "" {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusNotAcceptable)
+				w.Write([]byte("acceptable media types: " + strings.Join(offers, ", ") + "\n"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAccept rejects GET requests without an Accept header with 406
+// instead of answering them with the default representation, so strict
+// clients notice when a bug drops the header.
+func requireAccept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.TrimSpace(r.Header.Get("Accept")) == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write([]byte("an Accept header is required\n"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
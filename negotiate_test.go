@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"application/json;q=0.5, application/vnd.api+json", jsonAPIMediaType},
+		{"application/json, application/vnd.api+json;q=0.1", "application/json"},
+		{"application/*;q=0.2, application/vnd.api+json;q=0.1", "application/json"},
+		{"text/html, application/xhtml+xml, */*;q=0.8", "application/json"},
+		{"*/*;q=0.5, application/json;q=0", jsonAPIMediaType},
+		{"application/vnd.api+json, application/json", "application/json"},
+		{"not a media type, application/vnd.api+json;q=0.3", jsonAPIMediaType},
+		{"application/json;q=0", ""},
+		{"text/html, text/plain;q=0.5", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/students", nil)
+			r.Header.Set("Accept", tt.accept)
+			if got := negotiate(r, jsonMediaTypes...); got != tt.want {
+				t.Errorf("negotiate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptable(t *testing.T) {
+	tests := []struct {
+		target          string
+		accept          string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"/students", "text/html, application/json;q=0.9", http.StatusOK, "application/json"},
+		{"/students", "application/json;q=0.1, application/vnd.api+json;q=0.9", http.StatusOK, jsonAPIMediaType},
+		{"/students", "text/html, text/csv", http.StatusNotAcceptable, "text/plain"},
+		{"/students.csv", "application/json", http.StatusNotAcceptable, "text/plain"},
+		{"/students.csv", "text/*;q=0.5, application/json", http.StatusOK, "text/csv"},
+	}
+
+	h, _ := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.target+" "+tt.accept, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.target, "", "Accept", tt.accept)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantContentType) {
+				t.Errorf("Content-Type %q, want %s", got, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestRequireAccept(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		method     string
+		target     string
+		accept     string
+		wantStatus int
+	}{
+		{"lenient without Accept", false, http.MethodGet, "/students", "", http.StatusOK},
+		{"lenient with Accept", false, http.MethodGet, "/students", "application/json", http.StatusOK},
+		{"strict without Accept", true, http.MethodGet, "/students", "", http.StatusNotAcceptable},
+		{"strict with blank Accept", true, http.MethodGet, "/students", "  ", http.StatusNotAcceptable},
+		{"strict with Accept", true, http.MethodGet, "/students", "application/json", http.StatusOK},
+		{"strict with wildcard", true, http.MethodGet, "/students", "*/*", http.StatusOK},
+		{"strict, versioned route", true, http.MethodGet, "/api/v1/students", "", http.StatusNotAcceptable},
+		{"strict, write", true, http.MethodPost, "/students", "", http.StatusCreated},
+		{"strict, health check", true, http.MethodGet, "/healthz", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RequireAccept = tt.strict
+			h, _ := newTestRouter(t, WithConfig(cfg))
+
+			body := ""
+			if tt.method == http.MethodPost {
+				body = studentJSON("1301")
+			}
+			rec := serve(h, tt.method, tt.target, body, "Accept", tt.accept)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+const (
+	nimStrategyRandom   = "random"
+	nimStrategySequence = "sequence"
+	nimStrategyNone     = "none"
+)
+
+// generatedNIMDigits is the width of the numeric part of generated NIMs.
+const generatedNIMDigits = 8
+
+// maxNIMAttempts bounds how often a colliding generated NIM is replaced
+// before giving up.
+const maxNIMAttempts = 5
+
+// nextNIM returns a NIM for a student created without one, following the
+// configured strategy: random appends random digits to the prefix, sequence
+// the successor of the highest number already used with the prefix. The
+// caller still has to cope with a collision, which for random is rare and
+// for sequence means a concurrent insert took the number first.
+func (h *handler) nextNIM(ds *Datastore) (string, error) {
+	prefix := h.cfg.NIMPrefix
+
+	switch h.cfg.NIMStrategy {
+	case nimStrategySequence:
+		last, err := ds.LastNIMSequence(prefix)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%0*d", prefix, generatedNIMDigits, last+1), nil
+	default:
+		max := new(big.Int).Exp(big.NewInt(10), big.NewInt(generatedNIMDigits), nil)
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%0*d", prefix, generatedNIMDigits, n), nil
+	}
+}
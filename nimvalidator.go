@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// NIMValidator checks that a NIM has the format of the institution, on top
+// of the rules every NIM follows.
+type NIMValidator interface {
+	// Validate returns an error describing what is wrong with nim, to be
+	// reported for the nim field, or nil.
+	Validate(nim string) error
+}
+
+// newNIMValidator returns the validator for NIM_PATTERN: a regular
+// expression, in Go's RE2 syntax, that a NIM must match as a whole. An empty
+// pattern accepts any NIM.
+func newNIMValidator(pattern string) (NIMValidator, error) {
+	if pattern == "" {
+		return anyNIM{}, nil
+	}
+	// The pattern is compiled on its own first so that errors quote it as
+	// it was written; a valid pattern stays valid once anchored.
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	return patternNIM{pattern: pattern, re: regexp.MustCompile("^(?:" + pattern + ")$")}, nil
+}
+
+type anyNIM struct{}
+
+func (anyNIM) Validate(string) error { return nil }
+
+type patternNIM struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func (v patternNIM) Validate(nim string) error {
+	if !v.re.MatchString(nim) {
+		return fmt.Errorf("must match the pattern %s", v.pattern)
+	}
+	return nil
+}
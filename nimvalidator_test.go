@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNIMValidator(t *testing.T) {
+	tests := []struct {
+		pattern string
+		nim     string
+		valid   bool
+	}{
+		{"", "anything", true},
+		{"[0-9]{8}", "20210001", true},
+		{"[0-9]{8}", "2021001", false},
+		{"[0-9]{8}", "202100011", false},
+		{"[0-9]{8}", "2021000A", false},
+		{"[0-9]{8}", "x20210001", false},
+		{"[A-Z]{2}[0-9]{6}", "TI210001", true},
+		{"[A-Z]{2}[0-9]{6}", "ti210001", false},
+		{"[A-Z]{2}[0-9]{6}", "21000001", false},
+		// Alternatives are anchored as a whole, not just the first and last.
+		{"[0-9]{4}|[A-Z]{4}", "1234", true},
+		{"[0-9]{4}|[A-Z]{4}", "1234ABCD", false},
+	}
+
+	for _, tt := range tests {
+		v, err := newNIMValidator(tt.pattern)
+		if err != nil {
+			t.Fatalf("newNIMValidator(%q): %v", tt.pattern, err)
+		}
+		if err := v.Validate(tt.nim); (err == nil) != tt.valid {
+			t.Errorf("pattern %q, NIM %q: got %v, want valid %v", tt.pattern, tt.nim, err, tt.valid)
+		}
+	}
+}
+
+func TestNIMValidatorInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"[0-9", "(?P<x", "a{2,1}"} {
+		if _, err := newNIMValidator(pattern); err == nil {
+			t.Errorf("newNIMValidator(%q) accepted an invalid pattern", pattern)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.NIMPattern = "[0-9"
+	if err := cfg.validate(); err == nil {
+		t.Error("validate accepted an invalid NIM_PATTERN")
+	}
+
+	// The router leaves the pattern to the validator it is given, so an
+	// invalid one does not stop it from being built.
+	h, _ := newTestRouter(t, WithConfig(cfg))
+	if rec := serve(h, http.MethodGet, "/students", ""); rec.Code != http.StatusOK {
+		t.Errorf("status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestNIMPatternRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"create matching", http.MethodPost, "/students", studentJSON("20210002"), http.StatusCreated},
+		{"create not matching", http.MethodPost, "/students", studentJSON("2021A002"), http.StatusUnprocessableEntity},
+		{"batch not matching", http.MethodPost, "/students/batch", batchJSON("20210003", "2021"), http.StatusUnprocessableEntity},
+		{"validate not matching", http.MethodPost, "/students/validate", studentJSON("2021"), http.StatusUnprocessableEntity},
+		{"import not matching", http.MethodPost, "/students/import", "nim,name,age,address\n2021,Ana,20,Bandung\n", http.StatusUnprocessableEntity},
+		{"rename not matching", http.MethodPost, "/students/20210001/rename", `{"new_nim":"2021"}`, http.StatusUnprocessableEntity},
+		{"rename matching", http.MethodPost, "/students/20210001/rename", `{"new_nim":"20210009"}`, http.StatusOK},
+		{"stored before the pattern", http.MethodGet, "/students/legacy-1", "", http.StatusOK},
+		{"update stored before the pattern", http.MethodPut, "/students/legacy-1", `{"name":"Budi","age":21,"address":"Padang"}`, http.StatusOK},
+	}
+
+	cfg := testConfig()
+	cfg.NIMPattern = "[0-9]{8}"
+	nims, err := newNIMValidator(cfg.NIMPattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ds := newTestRouter(t, WithConfig(cfg), WithNIMValidator(nims))
+	addStudents(t, ds,
+		Student{NIM: "20210001", Name: "Ana", Age: 20, Address: "Bandung"},
+		Student{NIM: "legacy-1", Name: "Ana", Age: 20, Address: "Bandung"},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+	if n := countStudents(t, ds); n != 3 {
+		t.Errorf("%d students stored, want 3", n)
+	}
+}
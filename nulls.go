@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// omitNulls reports whether the client asked with ?omitempty=true for object
+// members whose value is null to be left out. By default they are sent, so
+// every response of a type has the same keys.
+func omitNulls(r *http.Request) bool {
+	omit, _ := strconv.ParseBool(r.URL.Query().Get("omitempty"))
+	return omit
+}
+
+// dropNulls removes the null members of every object in v. Nulls inside
+// arrays stay, since removing them would shift the positions of the others.
+func dropNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if val == nil {
+				delete(v, k)
+				continue
+			}
+			v[k] = dropNulls(val)
+		}
+		return v
+	case []any:
+		for i, val := range v {
+			v[i] = dropNulls(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestNullTimestamps(t *testing.T) {
+	h, ds := newTestRouter(t)
+
+	// Rows written around the API may lack timestamps.
+	_, err := ds.StudentSQLite.Exec("INSERT INTO students (nim, name, age, address, created_at, updated_at, school_id) VALUES (?, ?, ?, ?, NULL, NULL, ?)",
+		"2021000001", "Ana", 20, "Bandung", "school-a")
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		present bool
+	}{
+		{"sent as null by default", "/students/2021000001", true},
+		{"left out with omitempty", "/students/2021000001?omitempty=true", false},
+		{"null in a listing", "/students", true},
+		{"null in a page", "/students?limit=10", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.target, "", schoolHeader, "school-a")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			var doc any
+			if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("decode: %v: %s", err, rec.Body)
+			}
+			student, _ := doc.(map[string]any)
+			data, ok := doc.([]any)
+			if !ok {
+				data, ok = student["data"].([]any)
+			}
+			if ok {
+				if len(data) != 1 {
+					t.Fatalf("listing has %d students, want 1", len(data))
+				}
+				student = data[0].(map[string]any)
+			}
+
+			for _, key := range []string{"created_at", "updated_at"} {
+				v, ok := student[key]
+				if ok != tt.present {
+					t.Errorf("%s present = %v, want %v: %s", key, ok, tt.present, rec.Body)
+				}
+				if ok && v != nil {
+					t.Errorf("%s = %v, want null", key, v)
+				}
+			}
+		})
+	}
+}
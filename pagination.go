@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPageLimit = 50
+const maxPageLimit = 1000
+
+type listMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	// ServerTime is taken before the query runs; clients doing delta sync
+	// pass it back as the next modified_since.
+	ServerTime time.Time         `json:"server_time"`
+	Links      map[string]string `json:"links,omitempty"`
+	// QueryPlan is only set by ?explain=true in debug mode.
+	QueryPlan []queryPlanStep `json:"query_plan,omitempty"`
+}
+
+type listResponse struct {
+	Data []studentView `json:"data"`
+	Meta listMeta      `json:"meta"`
+}
+
+// parsePage reads the limit and offset query parameters. limit=0 is valid
+// and means no rows, only the meta, which is a cheap way to get the total.
+func parsePage(r *http.Request) (limit int, offset int, err error) {
+	limit = defaultPageLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be between 0 and %d", maxPageLimit)
+		}
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// pageRequested reports whether r asks for a page with limit or offset.
+// Lists requested without either are sent as a bare array of every matching
+// student, as they were before paging.
+func pageRequested(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("limit") || q.Has("offset")
+}
+
+// pageLinks returns absolute URLs for the current, first, previous, next and
+// last pages, keeping every other query parameter of r. prev is omitted on
+// the first page and next on the last. With limit=0 there are no pages to
+// move between, so only self is returned.
+func pageLinks(r *http.Request, m listMeta) map[string]string {
+	links := map[string]string{
+		"self": pageURL(r, m.Limit, m.Offset),
+	}
+	if m.Limit == 0 {
+		return links
+	}
+
+	links["first"] = pageURL(r, m.Limit, 0)
+
+	if m.Offset > 0 {
+		prev := m.Offset - m.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links["prev"] = pageURL(r, m.Limit, prev)
+	}
+	if m.Offset+m.Limit < m.Total {
+		links["next"] = pageURL(r, m.Limit, m.Offset+m.Limit)
+	}
+
+	last := 0
+	if m.Total > 0 {
+		last = (m.Total - 1) / m.Limit * m.Limit
+	}
+	links["last"] = pageURL(r, m.Limit, last)
+
+	return links
+}
+
+// itemsRange is a parsed "Range: items=first-last" header, both inclusive.
+type itemsRange struct {
+	First int
+	Last  int
+}
+
+// parseItemsRange reads a Range header in the items unit some legacy
+// clients paginate with. ok is false when there is no such header, in which
+// case the query parameters apply. Ranges wider than maxPageLimit are
+// shortened.
+func parseItemsRange(r *http.Request) (rng itemsRange, ok bool, err error) {
+	v := strings.TrimSpace(r.Header.Get("Range"))
+	if !strings.HasPrefix(v, "items=") {
+		return itemsRange{}, false, nil
+	}
+	spec := strings.TrimPrefix(v, "items=")
+
+	first, last, found := strings.Cut(spec, "-")
+	rng.First, err = strconv.Atoi(strings.TrimSpace(first))
+	if err == nil && found {
+		rng.Last, err = strconv.Atoi(strings.TrimSpace(last))
+	}
+	if err != nil || !found || rng.First < 0 || rng.Last < rng.First {
+		return itemsRange{}, false, fmt.Errorf("Range must have the form items=first-last")
+	}
+
+	if rng.Last-rng.First+1 > maxPageLimit {
+		rng.Last = rng.First + maxPageLimit - 1
+	}
+	return rng, true, nil
+}
+
+// linkRelations is the order relations appear in the Link header.
+var linkRelations = []string{"first", "prev", "next", "last"}
+
+// linkHeader formats links as an RFC 8288 Link header value so that generic
+// HTTP clients can paginate without parsing the body.
+func linkHeader(links map[string]string) string {
+	var parts []string
+	for _, rel := range linkRelations {
+		if u, ok := links[rel]; ok {
+			parts = append(parts, fmt.Sprintf(`<%s>; rel="%s"`, u, rel))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func pageURL(r *http.Request, limit, offset int) string {
+	q := r.URL.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+
+	u := url.URL{
+		Scheme:   requestScheme(r),
+		Host:     r.Host,
+		Path:     r.URL.Path,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
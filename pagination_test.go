@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLinkHeader(t *testing.T) {
+	const base = "http://example.com/students?fields=nim"
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{
+			"first page",
+			"/students?fields=nim&limit=2",
+			`<` + base + `&limit=2&offset=0>; rel="first", ` +
+				`<` + base + `&limit=2&offset=2>; rel="next", ` +
+				`<` + base + `&limit=2&offset=4>; rel="last"`,
+		},
+		{
+			"middle page",
+			"/students?fields=nim&limit=2&offset=2",
+			`<` + base + `&limit=2&offset=0>; rel="first", ` +
+				`<` + base + `&limit=2&offset=0>; rel="prev", ` +
+				`<` + base + `&limit=2&offset=4>; rel="next", ` +
+				`<` + base + `&limit=2&offset=4>; rel="last"`,
+		},
+		{
+			"last page",
+			"/students?fields=nim&limit=2&offset=4",
+			`<` + base + `&limit=2&offset=0>; rel="first", ` +
+				`<` + base + `&limit=2&offset=2>; rel="prev", ` +
+				`<` + base + `&limit=2&offset=4>; rel="last"`,
+		},
+		{
+			"single page",
+			"/students?fields=nim&offset=0",
+			`<` + base + `&limit=50&offset=0>; rel="first", ` +
+				`<` + base + `&limit=50&offset=0>; rel="last"`,
+		},
+		{
+			"not paged",
+			"/students?fields=nim",
+			"",
+		},
+	}
+
+	h, ds := newTestRouter(t)
+	seedStudents(t, ds, 5)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.target, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Link"); got != tt.want {
+				t.Errorf("Link\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantData   int
+		wantLinks  []string
+		wantLink   bool
+		wantError  string
+	}{
+		{"zero", "?limit=0", http.StatusOK, 0, []string{"self"}, false, ""},
+		{"zero past the end", "?limit=0&offset=10", http.StatusOK, 0, []string{"self"}, false, ""},
+		{"one", "?limit=1", http.StatusOK, 1, []string{"first", "last", "next", "self"}, true, ""},
+		{"negative", "?limit=-1", http.StatusBadRequest, 0, nil, false, "limit must be between 0 and 1000"},
+		{"negative offset", "?offset=-5", http.StatusBadRequest, 0, nil, false, "offset must be a non-negative integer"},
+		{"not a number", "?limit=ten", http.StatusBadRequest, 0, nil, false, "limit must be between 0 and 1000"},
+	}
+
+	h, ds := newTestRouter(t)
+	seedStudents(t, ds, 3)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError != "" {
+				var got errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Error != tt.wantError {
+					t.Errorf("body %s, want error %q", rec.Body, tt.wantError)
+				}
+				return
+			}
+
+			var got listResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(got.Data) != tt.wantData || got.Meta.Total != 3 {
+				t.Errorf("got %d of %d students, want %d of 3", len(got.Data), got.Meta.Total, tt.wantData)
+			}
+			var rels []string
+			for rel := range got.Meta.Links {
+				rels = append(rels, rel)
+			}
+			sort.Strings(rels)
+			if !reflect.DeepEqual(rels, tt.wantLinks) {
+				t.Errorf("links %v, want %v", rels, tt.wantLinks)
+			}
+			if hasLink := rec.Header().Get("Link") != ""; hasLink != tt.wantLink {
+				t.Errorf("Link header sent: %v, want %v", hasLink, tt.wantLink)
+			}
+		})
+	}
+}
+
+// TestListShape checks that GET /students stays a bare array of every
+// student unless a page is asked for.
+func TestListShape(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		header     []string
+		wantStatus int
+		wantPaged  bool
+		wantData   int
+	}{
+		{"not paged", "", nil, http.StatusOK, false, defaultPageLimit + 10},
+		{"filtered", "?min_age=0", nil, http.StatusOK, false, defaultPageLimit + 10},
+		{"limit", "?limit=5", nil, http.StatusOK, true, 5},
+		{"offset", "?offset=0", nil, http.StatusOK, true, defaultPageLimit},
+		{"range", "", []string{"Range", "items=0-4"}, http.StatusPartialContent, true, 5},
+	}
+
+	h, ds := newTestRouter(t)
+	seedStudents(t, ds, defaultPageLimit+10)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "", tt.header...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			var data []json.RawMessage
+			if tt.wantPaged {
+				var page listResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+					t.Fatalf("decode page: %v: %s", err, rec.Body)
+				}
+				if page.Meta.Total != defaultPageLimit+10 {
+					t.Errorf("meta.total %d, want %d", page.Meta.Total, defaultPageLimit+10)
+				}
+				data = make([]json.RawMessage, len(page.Data))
+			} else if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+				t.Fatalf("decode bare array: %v: %s", err, rec.Body)
+			}
+			if len(data) != tt.wantData {
+				t.Errorf("got %d students, want %d", len(data), tt.wantData)
+			}
+		})
+	}
+}
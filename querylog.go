@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// loggedConn runs queries on base with ctx, wraps each in a tracing span and
+// logs those that take longer than slow. A positive timeout bounds every
+// query, and every execution of a prepared statement, on top of whatever
+// deadline ctx already has.
+type loggedConn struct {
+	base    sqlConn
+	ctx     context.Context
+	slow    time.Duration
+	timeout time.Duration
+}
+
+func (c *loggedConn) Exec(query string, args ...any) (sql.Result, error) {
+	ctx, span := c.startSpan("Exec", query)
+	defer c.observe(span, query, time.Now())
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.base.ExecContext(ctx, query, args...)
+}
+
+func (c *loggedConn) Prepare(query string) (*loggedStmt, error) {
+	ctx, span := c.startSpan("Prepare", query)
+	defer c.observe(span, query, time.Now())
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	stmt, err := c.base.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedStmt{stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *loggedConn) Query(query string, args ...any) (*loggedRows, error) {
+	ctx, span := c.startSpan("Query", query)
+	defer c.observe(span, query, time.Now())
+	ctx, cancel := c.withTimeout(ctx)
+	rows, err := c.base.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &loggedRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (c *loggedConn) QueryRow(query string, args ...any) *loggedRow {
+	ctx, span := c.startSpan("QueryRow", query)
+	defer c.observe(span, query, time.Now())
+	ctx, cancel := c.withTimeout(ctx)
+	return &loggedRow{row: c.base.QueryRowContext(ctx, query, args...), cancel: cancel}
+}
+
+// withTimeout bounds ctx by c.timeout.
+func (c *loggedConn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// loggedStmt is a statement prepared by loggedConn. Each execution is
+// traced, logged and bounded like a query run on the connection itself.
+type loggedStmt struct {
+	stmt  *sql.Stmt
+	conn  *loggedConn
+	query string
+}
+
+func (s *loggedStmt) Exec(args ...any) (sql.Result, error) {
+	ctx, span := s.conn.startSpan("Exec", s.query)
+	defer s.conn.observe(span, s.query, time.Now())
+	ctx, cancel := s.conn.withTimeout(ctx)
+	defer cancel()
+	return s.stmt.ExecContext(ctx, args...)
+}
+
+func (s *loggedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+// loggedRows are the rows of a query run by loggedConn. They are read after
+// Query returns, so the query's timeout is released when they are closed.
+type loggedRows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+func (r *loggedRows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+// loggedRow is the row of a query run by loggedConn; Scan releases the
+// query's timeout.
+type loggedRow struct {
+	row    *sql.Row
+	cancel context.CancelFunc
+}
+
+func (r *loggedRow) Scan(dest ...any) error {
+	defer r.cancel()
+	return r.row.Scan(dest...)
+}
+
+func (r *loggedRow) Err() error {
+	return r.row.Err()
+}
+
+func (c *loggedConn) startSpan(op string, query string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(c.ctx, "sqlite."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.statement", query),
+		))
+}
+
+func (c *loggedConn) observe(span trace.Span, query string, start time.Time) {
+	span.End()
+
+	if c.slow <= 0 {
+		return
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < c.slow {
+		return
+	}
+
+	query = strings.Join(strings.Fields(query), " ")
+	if reqID := middleware.GetReqID(c.ctx); reqID != "" {
+		log.Printf("WARN slow query [%s] took %s: %s", reqID, elapsed, query)
+		return
+	}
+	log.Printf("WARN slow query took %s: %s", elapsed, query)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowQuery counts to a billion, which takes SQLite far longer than the
+// timeout the tests set.
+const slowQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT count(*) FROM c`
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(conn dbtx) error
+	}{
+		{"exec", func(conn dbtx) error {
+			_, err := conn.Exec(slowQuery)
+			return err
+		}},
+		{"prepared statement", func(conn dbtx) error {
+			stmt, err := conn.Prepare(slowQuery)
+			if err != nil {
+				return err
+			}
+			defer stmt.Close()
+			_, err = stmt.Exec()
+			return err
+		}},
+		{"query", func(conn dbtx) error {
+			rows, err := conn.Query(slowQuery)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+			}
+			return rows.Err()
+		}},
+		{"query row", func(conn dbtx) error {
+			var n int
+			return conn.QueryRow(slowQuery).Scan(&n)
+		}},
+	}
+
+	ds := newTestDatastore(t)
+	ds.queryTimeout = 50 * time.Millisecond
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			err := tt.run(ds.conn())
+			if err == nil {
+				t.Fatal("slow query succeeded, want it to time out")
+			}
+			if !errors.Is(err, context.DeadlineExceeded) && err.Error() != "interrupted" {
+				t.Errorf("err = %v, want a timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("query ran for %s despite a %s timeout", elapsed, ds.queryTimeout)
+			}
+		})
+	}
+}
+
+func TestQueryTimeoutStatus(t *testing.T) {
+	ds := newTestDatastore(t)
+	ds.queryTimeout = 50 * time.Millisecond
+
+	var n int
+	err := ds.conn().QueryRow(slowQuery).Scan(&n)
+
+	rec := httptest.NewRecorder()
+	respondDatastoreError(rec, httptest.NewRequest(http.MethodGet, "/students", nil), err)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("timed out query answered %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestQueryTimeoutSpared(t *testing.T) {
+	ds := newTestDatastore(t)
+	seedStudents(t, ds, 10)
+	ds.queryTimeout = time.Nanosecond
+
+	// The export scan is bounded by the request alone.
+	rows := 0
+	if err := ds.EachStudent(studentFilter{}, func(Student) error { rows++; return nil }); err != nil {
+		t.Fatalf("export scan: %v", err)
+	}
+	if rows != 10 {
+		t.Errorf("scanned %d students, want 10", rows)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// respondJSON writes v as JSON. Clients asking for JSON:API get v converted
+// to a JSON:API document instead, clients asking for another key naming get
+// the keys renamed, and clients passing ?omitempty=true get null members
+// left out.
+func respondJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	contentType := "application/json"
+	if wantsJSONAPI(r) {
+		v = toJSONAPI(r, status, v)
+		contentType = jsonAPIMediaType
+	} else if wrapLists(r) {
+		v = wrapList(v)
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	var rewrites []func(any) any
+	if rename := keyNaming(r); rename != nil {
+		rewrites = append(rewrites, func(doc any) any { return renameKeys(doc, rename) })
+	}
+	if omitNulls(r) {
+		rewrites = append(rewrites, dropNulls)
+	}
+
+	out := body.Bytes()
+	if len(rewrites) > 0 {
+		rewritten, err := rewriteJSON(out, rewrites...)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		out = rewritten
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// rewriteJSON decodes the encoded document b, applies every rewrite to it in
+// turn and encodes it again. Working on the encoded form means no type needs
+// a second set of tags.
+func rewriteJSON(b []byte, rewrites ...func(any) any) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	for _, rewrite := range rewrites {
+		doc = rewrite(doc)
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+type errorResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func respondError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	respondJSON(w, r, status, errorResponse{Error: message})
+}
+
+// respondValidationError answers requests that were well formed but break
+// the business rules checked by Validate. Requests that cannot be parsed at
+// all, malformed bodies and query parameters, get 400 through respondError
+// instead.
+func respondValidationError(w http.ResponseWriter, r *http.Request, errs ValidationErrors) {
+	respondJSON(w, r, http.StatusUnprocessableEntity, errorResponse{
+		Error:  "validation failed",
+		Fields: errs,
+	})
+}
+
+// storageRetryAfter is the Retry-After sent while the database cannot be
+// written; disk problems take an operator, not a quick retry.
+const storageRetryAfter = 60 * time.Second
+
+// respondDatastoreError maps an error returned by the Datastore to a status.
+// A constraint violation, i.e. a NIM already taken within its scope, is a
+// conflict.
+// A query that ran out of time, whether DB_QUERY_TIMEOUT or the request
+// timeout ended it, is a gateway timeout.
+// A missing table that could not be recreated means the service cannot work
+// until an operator steps in, so it is reported as 503, and so is a database
+// that cannot be written, while reads go on being served.
+// Any other error is logged and answered with a generic 500, so SQL and
+// driver messages never reach the client.
+func respondDatastoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errDataNotFound):
+		respondError(w, r, http.StatusNotFound, err.Error())
+	case isConstraintError(err):
+		respondError(w, r, http.StatusConflict, err.Error())
+	case isStorageUnavailable(err):
+		storageAlert.report(err)
+		w.Header().Set("Retry-After", strconv.Itoa(int(storageRetryAfter.Seconds())))
+		respondError(w, r, http.StatusServiceUnavailable, "database is not writable, try again later")
+	case errors.Is(err, context.DeadlineExceeded):
+		respondError(w, r, http.StatusGatewayTimeout, "database query timed out")
+	case errors.Is(err, errSchemaUnavailable), isMissingTable(err):
+		respondError(w, r, http.StatusServiceUnavailable, errSchemaUnavailable.Error())
+	default:
+		log.Printf("ERROR [%s] %s %s: %v", middleware.GetReqID(r.Context()), r.Method, r.URL.Path, err)
+		respondError(w, r, http.StatusInternalServerError, errInternalServer.Error())
+	}
+}
+
+// storageAlert logs write failures caused by the disk at most once a minute,
+// so an outage raises an alert without flooding the log with one line per
+// request.
+var storageAlert alertThrottle
+
+type alertThrottle struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+func (a *alertThrottle) report(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if time.Since(a.last) < time.Minute {
+		a.suppressed++
+		return
+	}
+	log.Printf("CRITICAL database is not writable, writes answer 503 until it is fixed: %v (%d more failures since the last alert)", err, a.suppressed)
+	a.last = time.Now()
+	a.suppressed = 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRespondDatastoreError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		want      int
+		wantError string
+		wantLog   bool
+	}{
+		{"not found", errDataNotFound, http.StatusNotFound, errDataNotFound.Error(), false},
+		{"timed out", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "database query timed out", false},
+		{"schema unavailable", errSchemaUnavailable, http.StatusServiceUnavailable, errSchemaUnavailable.Error(), false},
+		{"unexpected", errors.New(`no such column: "secret_notes"`), http.StatusInternalServerError, "internal server error", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			prevOut, prevFlags := log.Writer(), log.Flags()
+			log.SetOutput(&logged)
+			log.SetFlags(0)
+			t.Cleanup(func() {
+				log.SetOutput(prevOut)
+				log.SetFlags(prevFlags)
+			})
+
+			rec := httptest.NewRecorder()
+			respondDatastoreError(rec, httptest.NewRequest(http.MethodGet, "/students", nil), tt.err)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+			var body errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != tt.wantError {
+				t.Errorf("body %s, want error %q", rec.Body, tt.wantError)
+			}
+
+			if hasLog := strings.Contains(logged.String(), tt.err.Error()); hasLog != tt.wantLog {
+				t.Errorf("error logged: %v, want %v: %q", hasLog, tt.wantLog, logged.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type routerOptions struct {
+	logger     bool
+	recoverer  bool
+	middleware []func(http.Handler) http.Handler
+	cfg        config
+	inflight   *inflightTracker
+	jobs       *jobRunner
+	nims       NIMValidator
+}
+
+type RouterOption func(*routerOptions)
+
+// WithoutLogger disables chi's request logger, e.g. to keep test output quiet.
+func WithoutLogger() RouterOption {
+	return func(o *routerOptions) {
+		o.logger = false
+	}
+}
+
+// WithoutRecoverer disables panic recovery so panics reach the caller.
+func WithoutRecoverer() RouterOption {
+	return func(o *routerOptions) {
+		o.recoverer = false
+	}
+}
+
+// WithMiddleware appends extra middleware after the built-in stack.
+func WithMiddleware(mw ...func(http.Handler) http.Handler) RouterOption {
+	return func(o *routerOptions) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+// WithConfig sets the runtime configuration used by the handlers.
+func WithConfig(cfg config) RouterOption {
+	return func(o *routerOptions) {
+		o.cfg = cfg
+	}
+}
+
+// WithInflightTracker counts requests in flight with t instead of a tracker
+// private to the router, so the caller can watch them during shutdown.
+func WithInflightTracker(t *inflightTracker) RouterOption {
+	return func(o *routerOptions) {
+		o.inflight = t
+	}
+}
+
+// WithJobRunner runs background import jobs with j instead of a runner
+// private to the router, so the caller can wait for them during shutdown.
+func WithJobRunner(j *jobRunner) RouterOption {
+	return func(o *routerOptions) {
+		o.jobs = j
+	}
+}
+
+// WithNIMValidator checks new NIMs with v, e.g. the validator for
+// NIM_PATTERN, instead of accepting any NIM that follows the common rules.
+func WithNIMValidator(v NIMValidator) RouterOption {
+	return func(o *routerOptions) {
+		o.nims = v
+	}
+}
+
+func newRouter(datastore *Datastore, opts ...RouterOption) http.Handler {
+	o := routerOptions{
+		logger:    true,
+		recoverer: true,
+		cfg:       defaultConfig(),
+		inflight:  newInflightTracker(),
+		jobs:      newJobRunner(),
+		nims:      anyNIM{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := chi.NewRouter()
+
+	slo := newSLOMonitor(o.cfg.SLOBudget, o.cfg.SLORouteBudgets)
+	cache := newTTLCache(o.cfg.CacheTTL)
+
+	r.Use(o.inflight.Middleware)
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP)
+	r.Use(overrideMethod)
+	r.Use(aliasParams(paramAliases))
+	if o.cfg.SLOBudget > 0 || len(o.cfg.SLORouteBudgets) > 0 {
+		r.Use(slo.Middleware)
+	}
+	if o.cfg.TracingEndpoint != "" {
+		r.Use(traceRequests)
+	}
+	if o.logger {
+		r.Use(requestLogger())
+	}
+	if o.recoverer {
+		r.Use(middleware.Recoverer)
+	}
+	r.Use(compressResponse(o.cfg.CompressThreshold))
+	r.Use(trailingSlashes)
+	r.Use(answerOptions(r))
+	r.Use(decompressRequest(o.cfg.MaxDecompressedBody))
+	r.Use(cache.invalidateOnWrite)
+	r.Use(o.middleware...)
+	r.NotFound(routeNotFound)
+	r.MethodNotAllowed(methodNotAllowed)
+
+	h := &handler{datastore: datastore, cfg: o.cfg, cache: cache, nims: o.nims, jobs: o.jobs}
+
+	// Timeouts are set per route: regular requests get RequestTimeout while
+	// bulk operations that legitimately run longer get LongRequestTimeout.
+	timeout := middleware.Timeout(o.cfg.RequestTimeout)
+	longTimeout := middleware.Timeout(o.cfg.LongRequestTimeout)
+
+	dedupe := newDedupeWindow(o.cfg.DedupeWindow)
+
+	// The student API is served under /api/v1 and, for clients from before
+	// versioning, at the root, where DEPRECATED_ROUTES can flag routes as
+	// deprecated.
+	studentRoutes := func(r chi.Router) {
+		r.Use(scopeToSchool(o.cfg.RequireSchoolID))
+		if o.cfg.RequireAccept {
+			r.Use(requireAccept)
+		}
+
+		r.Group(func(r chi.Router) {
+			r.Use(timeout)
+			r.Use(txMiddleware(datastore))
+
+			r.With(dedupe.Middleware, requireJSONShape('{')).Post("/students", h.createStudent)
+			r.With(dedupe.Middleware, requireJSONShape('[')).Post("/students/batch", h.createStudents)
+			r.Delete("/students/batch", h.deleteStudents)
+			r.Delete("/students/{nim}", h.deleteStudent)
+			r.Delete("/students/{nim}/address", h.resetAddress)
+			r.With(requireJSONShape('{')).Put("/students", h.updateStudent)
+			r.With(requireJSONShape('{')).Post("/students/{nim}/rename", h.renameStudent)
+			r.With(requireJSONShape('[')).Put("/students/batch", h.updateStudents)
+			r.With(requireJSONShape('{')).Put("/students/{nim}", h.replaceStudent)
+			r.Put("/students/{nim}/{field}/{value}", h.updateField)
+		})
+
+		// Imports commit chunk by chunk, so they manage their own transactions.
+		r.With(longTimeout).Post("/students/import", h.importStudents)
+
+		r.With(timeout, requireJSONShape('{')).Post("/students/validate", h.validateStudent)
+		r.With(timeout, requireJSONShape('[')).Post("/students/batch/validate", h.validateStudents)
+		r.With(timeout, acceptable(jsonMediaTypes...)).Post("/students/lookup", h.lookupStudents)
+
+		// GET routes answer 406 when the client accepts none of the formats
+		// they produce.
+		acceptJSON := acceptable(jsonMediaTypes...)
+
+		r.With(timeout, acceptJSON).Get("/students", h.listStudents)
+		r.With(longTimeout, acceptable("text/csv")).Get("/students.csv", h.exportCSV)
+		r.With(timeout, acceptJSON).Get("/students/today", h.studentsCreatedToday)
+		r.With(timeout, acceptJSON).Get("/students/random", h.randomStudents)
+		r.With(timeout, acceptJSON).Get("/students/stats", h.studentStats)
+		r.With(timeout, acceptJSON).Get("/students/addresses", h.addressCounts)
+		r.With(timeout, acceptJSON).Get("/students/age-distribution", h.ageDistribution)
+		r.With(timeout, acceptJSON).Get("/students/{nim}", h.getStudent)
+		r.With(timeout, acceptJSON).Get("/students/{nim}/similar", h.similarStudents)
+		r.With(timeout, acceptJSON).Get("/jobs/{id}", h.getJob)
+		r.With(timeout, acceptJSON).Get("/schema", h.getSchema)
+	}
+
+	r.Route("/api/v1", studentRoutes)
+	r.Group(func(r chi.Router) {
+		r.Use(deprecate(o.cfg.DeprecatedRoutes, o.cfg.SunsetDate))
+		studentRoutes(r)
+	})
+
+	r.With(acceptable("text/plain")).Get("/metrics", serveMetrics(slo, cache, o.inflight))
+	r.With(timeout).Get("/healthz", h.healthz)
+
+	// Admin routes are only mounted when an API key is configured.
+	if o.cfg.APIKey != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(requireAPIKey(o.cfg.APIKey))
+
+			r.With(longTimeout).Post("/maintenance", h.runMaintenance)
+			r.With(longTimeout).Get("/backup", h.backupDatabase)
+			r.With(longTimeout, scopeToSchool(o.cfg.RequireSchoolID)).Get("/export.json", h.exportJSON)
+		})
+	}
+
+	if o.cfg.Debug {
+		logRoutes(r)
+	}
+
+	return r
+}
+
+// logRoutes logs every registered route, to confirm at startup that routes
+// are wired as expected after a refactor.
+func logRoutes(routes chi.Routes) {
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		slog.Debug("route", "method", method, "pattern", route, "middlewares", len(middlewares))
+		return nil
+	})
+	if err != nil {
+		slog.Debug("listing routes failed", "err", err)
+	}
+}
+
+// probedMethods are the methods an OPTIONS response may list in Allow.
+var probedMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// answerOptions answers OPTIONS requests with the methods routes serves
+// the path with, so the Allow header always reflects the registered routes.
+// It runs before routing; OPTIONS requests for paths no route matches are
+// passed on and end up as 404.
+func answerOptions(routes chi.Routes) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			path := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+				path = rctx.RoutePath
+			}
+
+			var allowed []string
+			for _, method := range probedMethods {
+				if routes.Match(chi.NewRouteContext(), method, path) {
+					allowed = append(allowed, method)
+				}
+			}
+			if len(allowed) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
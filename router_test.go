@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"collection", http.MethodOptions, "/students", http.StatusNoContent, "GET, POST, PUT, OPTIONS"},
+		{"student", http.MethodOptions, "/students/1301", http.StatusNoContent, "GET, PUT, DELETE, OPTIONS"},
+		{"address", http.MethodOptions, "/students/1301/address", http.StatusNoContent, "DELETE, OPTIONS"},
+		{"trailing slash", http.MethodOptions, "/students/1301/", http.StatusNoContent, "GET, PUT, DELETE, OPTIONS"},
+		{"unknown path", http.MethodOptions, "/teachers", http.StatusNotFound, ""},
+		{"GET of an unknown path", http.MethodGet, "/teachers", http.StatusNotFound, ""},
+	}
+
+	h, _ := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// migrations create the schema. Every statement must be idempotent: they run
+// at startup and again whenever a table turns out to be missing at runtime.
+// ADD COLUMN is the exception SQLite forces on us; migrate skips it when the
+// column already exists.
+var migrations = []string{
+	createStudentsTable,
+	// Timestamps were added after the first release. Rows from before then
+	// get the time of the migration.
+	`ALTER TABLE students ADD COLUMN created_at TEXT`,
+	`ALTER TABLE students ADD COLUMN updated_at TEXT`,
+	`UPDATE students SET created_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now') WHERE created_at IS NULL`,
+	`UPDATE students SET updated_at = created_at WHERE updated_at IS NULL`,
+	// Tenants came later still. Existing rows belong to the empty school,
+	// which is what single-tenant deployments keep using.
+	`ALTER TABLE students ADD COLUMN school_id TEXT NOT NULL DEFAULT ''`,
+	// Every query is scoped to a school, so the indexes for the filters
+	// lead with school_id and make an index on it alone redundant. Each
+	// index costs a little on every write. The name filter has none: it
+	// matches anywhere in the name, which no index can serve.
+	`DROP INDEX IF EXISTS students_school_id`,
+	`CREATE INDEX IF NOT EXISTS students_school_age ON students(school_id, age)`,
+	`CREATE INDEX IF NOT EXISTS students_school_address ON students(school_id, address)`,
+	// NOCASE serves both nim_prefix, since LIKE ignores case, and lookups
+	// with NIM_CASE_INSENSITIVE.
+	`CREATE INDEX IF NOT EXISTS students_school_nim ON students(school_id, nim COLLATE NOCASE)`,
+	// Background imports keep their state here so it survives a restart.
+	createJobsTable,
+}
+
+// migrate creates or updates the schema, with NIMs unique within nimScope.
+func migrate(ctx context.Context, conn sqlConn, nimScope string) error {
+	if err := runMigrations(ctx, conn); err != nil {
+		return err
+	}
+	return rebuildStudents(ctx, conn, nimScope)
+}
+
+func runMigrations(ctx context.Context, conn sqlConn) error {
+	for _, stmt := range migrations {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil && !isDuplicateColumn(err) {
+			return fmt.Errorf("%q: %s", err, stmt)
+		}
+	}
+	return nil
+}
+
+const (
+	// nimScopeGlobal makes a NIM unique across all schools.
+	nimScopeGlobal = "global"
+	// nimScopeSchool makes a NIM unique within its school only, for
+	// deployments whose schools hand out NIMs independently.
+	nimScopeSchool = "school"
+)
+
+// studentsPrimaryKeys are the primary keys of the students table for each
+// NIM scope.
+var studentsPrimaryKeys = map[string]string{
+	nimScopeGlobal: "PRIMARY KEY (nim)",
+	nimScopeSchool: "PRIMARY KEY (school_id, nim)",
+}
+
+// studentsChecks bound the text columns by the limits Validate enforces, so
+// rows written around the API are held to them too. SQLite's length counts
+// characters, as Validate does.
+var studentsChecks = fmt.Sprintf("CHECK (length(name) <= %d), CHECK (length(address) <= %d)", maxNameLength, maxAddressLength)
+
+// rebuildStudents rebuilds the students table when its primary key does not
+// match nimScope or it lacks the current studentsChecks. SQLite can alter
+// neither, so the rows are copied into a new table in one transaction. The
+// rebuild fails, leaving the table as it was, when going from school to
+// global scope while two schools share a NIM, or when a stored row breaks a
+// check. Foreign keys are enforced, which dropping the old table would trip
+// if another table referred to students; none does.
+func rebuildStudents(ctx context.Context, conn sqlConn, nimScope string) error {
+	primaryKey, ok := studentsPrimaryKeys[nimScope]
+	if !ok {
+		return fmt.Errorf("unknown NIM scope %q, expected %s or %s", nimScope, nimScopeGlobal, nimScopeSchool)
+	}
+
+	var keyColumns int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('students') WHERE pk > 0").Scan(&keyColumns)
+	if err != nil {
+		return err
+	}
+	var definition string
+	err = conn.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'students'").Scan(&definition)
+	if err != nil {
+		return err
+	}
+	rekey := (keyColumns == 2) != (nimScope == nimScopeSchool)
+	if !rekey && strings.Contains(definition, studentsChecks) {
+		return nil
+	}
+
+	// Inside a transaction the caller commits; on the pool the rebuild gets
+	// a transaction of its own.
+	var own *sql.Tx
+	if db, ok := conn.(*sql.DB); ok {
+		if own, err = db.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		defer own.Rollback()
+		conn = own
+	}
+
+	stmts := []string{
+		`CREATE TABLE students_rebuilt (nim TEXT NOT NULL, name TEXT NOT NULL, age INTEGER NOT NULL, address TEXT NOT NULL,
+			created_at TEXT, updated_at TEXT, school_id TEXT NOT NULL DEFAULT '', ` + primaryKey + `, ` + studentsChecks + `)`,
+		`INSERT INTO students_rebuilt (` + studentColumns + `, school_id) SELECT ` + studentColumns + `, school_id FROM students`,
+		`DROP TABLE students`,
+		`ALTER TABLE students_rebuilt RENAME TO students`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			if rekey {
+				return fmt.Errorf("making NIMs unique per %s: %w", nimScope, err)
+			}
+			return fmt.Errorf("adding name and address length limits to the students table: %w", err)
+		}
+	}
+	// Dropping the old table dropped its indexes.
+	if err := runMigrations(ctx, conn); err != nil {
+		return err
+	}
+
+	if own != nil {
+		if err := own.Commit(); err != nil {
+			return err
+		}
+	}
+	log.Printf("students table rebuilt with NIMs unique per %s and name and address length limits", nimScope)
+	return nil
+}
+
+func isDuplicateColumn(err error) bool {
+	return strings.Contains(err.Error(), "duplicate column name")
+}
+
+func isMissingTable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
+
+// healSchema recreates the schema on conn after cause reported a missing
+// table and reports whether it succeeded.
+func healSchema(ctx context.Context, conn sqlConn, nimScope string, cause error) bool {
+	log.Printf("ERROR schema missing (%v), re-running migrations", cause)
+	if err := migrate(ctx, conn, nimScope); err != nil {
+		log.Printf("ERROR recreating schema failed: %v", err)
+		return false
+	}
+	log.Printf("ERROR schema recreated after it went missing at runtime")
+	return true
+}
+
+// withSchemaRetry runs fn and, if it failed because a table is missing, e.g.
+// one dropped by an external process, recreates the schema and runs fn once
+// more. Inside a transaction the schema is recreated in that transaction.
+func withSchemaRetry[T any](ds *Datastore, fn func() (T, error)) (T, error) {
+	v, err := fn()
+	if isMissingTable(err) && healSchema(ds.context(), ds.rawConn(), ds.nimScope, err) {
+		return fn()
+	}
+	return v, err
+}
+
+func retrySchema(ds *Datastore, fn func() error) error {
+	_, err := withSchemaRetry(ds, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
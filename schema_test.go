@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLengthChecks checks that the database itself rejects names and
+// addresses longer than Validate allows, counting characters.
+func TestLengthChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		student Student
+		wantErr bool
+	}{
+		{"longest name", Student{NIM: "1", Name: strings.Repeat("é", maxNameLength), Age: 20, Address: "Bandung"}, false},
+		{"name too long", Student{NIM: "2", Name: strings.Repeat("a", maxNameLength+1), Age: 20, Address: "Bandung"}, true},
+		{"longest address", Student{NIM: "3", Name: "Ana", Age: 20, Address: strings.Repeat("é", maxAddressLength)}, false},
+		{"address too long", Student{NIM: "4", Name: "Ana", Age: 20, Address: strings.Repeat("a", maxAddressLength+1)}, true},
+	}
+
+	ds := newTestDatastore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Insert directly, around Validate.
+			_, err := ds.StudentSQLite.Exec("INSERT INTO students (nim, name, age, address) VALUES (?, ?, ?, ?)",
+				tt.student.NIM, tt.student.Name, tt.student.Age, tt.student.Address)
+			if tt.wantErr && !isConstraintError(err) {
+				t.Errorf("err = %v, want a constraint error", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("err = %v, want none", err)
+			}
+		})
+	}
+}
+
+func TestGetSchema(t *testing.T) {
+	h, _ := newTestRouter(t)
+
+	rec := serve(h, http.MethodGet, "/schema", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	for _, want := range []string{`"name":"name","type":"string","required":true,"max_length":100`, `"max_length":255`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("schema %s lacks %s", rec.Body, want)
+		}
+	}
+}
+
+// TestLengthChecksAdded checks that a students table created before the
+// length checks gets them at startup, keeping its rows, and that a row
+// already too long stops the service instead.
+func TestLengthChecksAdded(t *testing.T) {
+	const legacyTable = `CREATE TABLE students (nim TEXT NOT NULL PRIMARY KEY, name TEXT NOT NULL, age INTEGER NOT NULL, address TEXT NOT NULL)`
+	tests := []struct {
+		name    string
+		student Student
+		wantErr bool
+	}{
+		{"rows within the limits", Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"}, false},
+		{"row too long", Student{NIM: "1301", Name: strings.Repeat("a", maxNameLength+1), Age: 20, Address: "Bandung"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "students.db")
+			db, err := sql.Open(sqliteDriver, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(legacyTable); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("INSERT INTO students (nim, name, age, address) VALUES (?, ?, ?, ?)",
+				tt.student.NIM, tt.student.Name, tt.student.Age, tt.student.Address); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			ds, err := newDatastore(path, nimScopeGlobal)
+			if tt.wantErr {
+				if err == nil {
+					ds.StudentSQLite.Close()
+					t.Fatal("added the checks to a table with a row breaking them")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { ds.StudentSQLite.Close() })
+
+			if got, err := ds.FindByNIM(tt.student.NIM); err != nil || got.Name != tt.student.Name {
+				t.Errorf("after the rebuild: %+v, %v, want %s", got, err, tt.student.Name)
+			}
+			_, err = ds.StudentSQLite.Exec("UPDATE students SET name = ?", strings.Repeat("a", maxNameLength+1))
+			if !isConstraintError(err) {
+				t.Errorf("over-long name after the rebuild: %v, want a constraint error", err)
+			}
+		})
+	}
+}
+
+// TestFreshSchemaNotRebuilt checks that a new database gets the checks when
+// the table is created, so neither the first start nor the next rebuilds it.
+func TestFreshSchemaNotRebuilt(t *testing.T) {
+	var logged bytes.Buffer
+	prevOut := log.Writer()
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(prevOut) })
+
+	path := filepath.Join(t.TempDir(), "students.db")
+	for i := 0; i < 2; i++ {
+		ds, err := newDatastore(path, nimScopeGlobal)
+		if err != nil {
+			t.Fatalf("open %d: %v", i+1, err)
+		}
+		ds.StudentSQLite.Close()
+	}
+
+	if strings.Contains(logged.String(), "rebuilt") {
+		t.Errorf("fresh database rebuilt: %s", logged.String())
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// similarNIMs returns the NIMs of a GET /students/{nim}/similar response in
+// order.
+func similarNIMs(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var students []Student
+	if err := json.Unmarshal(body, &students); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	nims := []string{}
+	for _, s := range students {
+		nims = append(nims, s.NIM)
+	}
+	return nims
+}
+
+func TestSimilarStudents(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		want       []string
+	}{
+		// 1301 is 20 and lives in Bandung: 1302 and 1306 share the address,
+		// 1303 (22), 1304 (18) and 1307 (21) are within two years of age,
+		// and 1305 (23, Medan) is neither.
+		{"address first, then closest age", "/students/1301/similar", http.StatusOK, []string{"1302", "1306", "1307", "1303", "1304"}},
+		{"limit", "/students/1301/similar?limit=3", http.StatusOK, []string{"1302", "1306", "1307"}},
+		{"nobody similar", "/students/1308/similar", http.StatusOK, []string{}},
+		{"unknown student", "/students/1399/similar", http.StatusNotFound, nil},
+		{"invalid limit", "/students/1301/similar?limit=0", http.StatusBadRequest, nil},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds,
+		Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"},
+		Student{NIM: "1302", Name: "Budi", Age: 40, Address: "Bandung"},
+		Student{NIM: "1303", Name: "Citra", Age: 22, Address: "Jakarta"},
+		Student{NIM: "1304", Name: "Dewi", Age: 18, Address: "Padang"},
+		Student{NIM: "1305", Name: "Eko", Age: 23, Address: "Medan"},
+		Student{NIM: "1306", Name: "Fajar", Age: 60, Address: "Bandung"},
+		Student{NIM: "1307", Name: "Gita", Age: 21, Address: "Surabaya"},
+		Student{NIM: "1308", Name: "Hadi", Age: 90, Address: "Ambon"},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := similarNIMs(t, rec.Body.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("similar %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
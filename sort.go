@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sortableColumns are the columns listings can be ordered by.
+var sortableColumns = []string{"nim", "name", "age", "address", "created_at", "updated_at"}
+
+// sortOrder orders a listing by one column, with the NIM breaking ties so
+// that the order is total and offset pagination stable. The zero value
+// orders by NIM ascending.
+type sortOrder struct {
+	Column string
+	Desc   bool
+}
+
+// parseSortOrder parses a column name, prefixed with "-" for descending
+// order, e.g. "-created_at".
+func parseSortOrder(v string) (sortOrder, error) {
+	var s sortOrder
+	if strings.HasPrefix(v, "-") {
+		s.Desc = true
+		v = strings.TrimPrefix(v, "-")
+	}
+	for _, c := range sortableColumns {
+		if c == v {
+			s.Column = v
+			return s, nil
+		}
+	}
+	return sortOrder{}, fmt.Errorf("unknown sort column %q, expected one of %s", v, strings.Join(sortableColumns, ", "))
+}
+
+func (s sortOrder) String() string {
+	column := s.Column
+	if column == "" {
+		column = "nim"
+	}
+	if s.Desc {
+		return "-" + column
+	}
+	return column
+}
+
+// orderBy returns the ORDER BY clause, with a leading space. Terms in
+// first, if any, order the rows before the column does.
+func (s sortOrder) orderBy(first ...string) string {
+	column := s.Column
+	if column == "" {
+		column = "nim"
+	}
+
+	clause := " ORDER BY " + strings.Join(append(first, column), ", ")
+	if s.Desc {
+		clause += " DESC"
+	}
+	if column != "nim" {
+		clause += ", nim"
+	}
+	return clause
+}
+
+// searchRank returns an ORDER BY term ranking the matches of a ?q= search
+// and its arguments: students named exactly query first, then those whose
+// name starts with it, then those whose name contains it, and last those
+// only matched by NIM or address. Like the search it ignores ASCII case.
+func searchRank(query string) (string, []any) {
+	escaped := escapeLike(query)
+	return `CASE WHEN name LIKE ? ESCAPE '\' THEN 0 WHEN name LIKE ? ESCAPE '\' THEN 1 WHEN name LIKE ? ESCAPE '\' THEN 2 ELSE 3 END`,
+		[]any{escaped, escaped + "%", "%" + escaped + "%"}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestDefaultSort pages through a listing with many ties twice and checks
+// that both passes see every student once, in the same order.
+func TestDefaultSort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"1301", "1302", "1303", "1304", "1305", "1306"}},
+		{"-nim", []string{"1306", "1305", "1304", "1303", "1302", "1301"}},
+		{"age", []string{"1302", "1304", "1306", "1301", "1303", "1305"}},
+		{"-age", []string{"1301", "1303", "1305", "1302", "1304", "1306"}},
+		{"address", []string{"1301", "1302", "1303", "1304", "1305", "1306"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			cfg := testConfig()
+			if tt.sort != "" {
+				s, err := parseSortOrder(tt.sort)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cfg.DefaultSort = s
+			}
+			h, ds := newTestRouter(t, WithConfig(cfg))
+			// Two ages and a single address, so most rows tie. They are
+			// inserted out of NIM order.
+			for _, nim := range []string{"1304", "1301", "1306", "1303", "1302", "1305"} {
+				age := uint16(20)
+				if nim[3]%2 == 0 {
+					age = 19
+				}
+				addStudents(t, ds, Student{NIM: nim, Name: "Ana", Age: age, Address: "Bandung"})
+			}
+
+			for pass := 1; pass <= 2; pass++ {
+				var got []string
+				for offset := 0; offset < len(tt.want); offset += 2 {
+					rec := serve(h, http.MethodGet, fmt.Sprintf("/students?limit=2&offset=%d", offset), "")
+					if rec.Code != http.StatusOK {
+						t.Fatalf("status %d: %s", rec.Code, rec.Body)
+					}
+					got = append(got, listNIMs(t, rec)...)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("pass %d listed %v, want %v", pass, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    sortOrder
+		wantErr bool
+	}{
+		{"nim", sortOrder{Column: "nim"}, false},
+		{"-created_at", sortOrder{Column: "created_at", Desc: true}, false},
+		{"email", sortOrder{}, true},
+		{"--age", sortOrder{}, true},
+		{"", sortOrder{}, true},
+		{"age; DROP TABLE students", sortOrder{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSortOrder(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSortOrder(%q) = %+v, %v, want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSearchRelevance(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		// Exact name, name prefixes, name substrings, then the address.
+		{"groups", "?q=ANN", []string{"1305", "1302", "1304", "1301", "1306"}},
+		{"paged", "?q=ann&limit=2&offset=1", []string{"1302", "1304"}},
+		{"LIKE wildcards are literal", "?q=a_n", []string{}},
+		{"no search keeps the sort order", "", []string{"1301", "1302", "1303", "1304", "1305", "1306"}},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds,
+		Student{NIM: "1301", Name: "Joanna", Age: 20, Address: "Bandung"},
+		Student{NIM: "1302", Name: "Ann Lee", Age: 20, Address: "Bandung"},
+		Student{NIM: "1303", Name: "Budi", Age: 20, Address: "Padang"},
+		Student{NIM: "1304", Name: "Anne Marie", Age: 20, Address: "Bandung"},
+		Student{NIM: "1305", Name: "ann", Age: 20, Address: "Bandung"},
+		Student{NIM: "1306", Name: "Citra", Age: 20, Address: "Annapolis"},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, "/students"+tt.query, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if got := listNIMs(t, rec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// DEFAULT_SORT orders the students within each group.
+	cfg := testConfig()
+	cfg.DefaultSort = sortOrder{Column: "nim", Desc: true}
+	h = newRouter(ds, WithConfig(cfg), WithoutLogger(), WithoutRecoverer())
+	want := []string{"1305", "1304", "1302", "1301", "1306"}
+	if got := listNIMs(t, serve(h, http.MethodGet, "/students?q=ann", "")); !reflect.DeepEqual(got, want) {
+		t.Errorf("descending by NIM listed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"container/list"
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the go-sqlite3 driver with the functions SQLite does not
+// ship registered on every connection, and foreign keys enforced.
+const sqliteDriver = "sqlite3_chiao"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// SQLite ignores foreign keys unless each connection turns
+			// them on, and the pool opens connections as it pleases; a
+			// connection without them would let a delete orphan the
+			// rows referring to it.
+			if _, err := conn.Exec("PRAGMA foreign_keys = ON", nil); err != nil {
+				return err
+			}
+			// REGEXP is only syntax in SQLite; "x REGEXP y" calls the
+			// user function regexp(y, x).
+			if err := conn.RegisterFunc("regexp", sqlRegexp, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("weighted_rank", sqlWeightedRank, true)
+		},
+	})
+}
+
+// maxRegexpLength caps the patterns sqlRegexp accepts. Patterns come from
+// clients, and RE2 compiles a long one into a large program.
+const maxRegexpLength = 256
+
+// compiledRegexps caches patterns by source, since sqlRegexp is called once
+// per row with the same pattern. It keeps the most recently used ones only,
+// so clients sending ever new patterns cannot grow it.
+var compiledRegexps = newRegexpCache(64)
+
+func sqlRegexp(pattern, s string) (bool, error) {
+	re, err := compiledRegexps.compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// regexpCache is a least recently used cache of compiled patterns.
+type regexpCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *regexp.Regexp, most recently used first
+	entries map[string]*list.Element
+}
+
+func newRegexpCache(size int) *regexpCache {
+	return &regexpCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// compile returns pattern compiled, from the cache when it is there.
+func (c *regexpCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[pattern]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*regexp.Regexp), nil
+	}
+	c.mu.Unlock()
+
+	if len(pattern) > maxRegexpLength {
+		return nil, fmt.Errorf("regular expression is longer than %d bytes", maxRegexpLength)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[pattern]; !ok {
+		c.entries[pattern] = c.order.PushFront(re)
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*regexp.Regexp).String())
+		}
+	}
+	return re, nil
+}
+
+// sqlWeightedRank turns random, a value of SQLite's RANDOM(), into a sort key
+// such that ordering rows by it ascending picks each with a probability
+// proportional to weight: -ln(u)/weight for u uniform in (0, 1) is an
+// exponential draw with rate weight, and the row whose draw comes first wins.
+// Taking the first n rows repeats that without replacement.
+func sqlWeightedRank(random int64, weight float64) float64 {
+	// The top 53 bits make a float in [0, 1); the half keeps it off 0.
+	u := (float64(uint64(random)>>11) + 0.5) / (1 << 53)
+	return -math.Log(u) / weight
+}
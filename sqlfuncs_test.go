@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWeightedRandom draws one of two students, aged 20 and 60, many times
+// and checks that the older one comes up in proportion to its age, 75% of
+// the time.
+func TestWeightedRandom(t *testing.T) {
+	const draws = 4000
+	ds := newTestDatastore(t)
+	addStudents(t, ds,
+		Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"},
+		Student{NIM: "1302", Name: "Budi", Age: 60, Address: "Padang"},
+	)
+
+	older := 0
+	for i := 0; i < draws; i++ {
+		picked, err := ds.FindRandom(1, "age")
+		if err != nil {
+			t.Fatalf("draw %d: %v", i, err)
+		}
+		if len(picked) != 1 {
+			t.Fatalf("draw %d picked %d students", i, len(picked))
+		}
+		if picked[0].Age == 60 {
+			older++
+		}
+	}
+
+	// The share's standard deviation is sqrt(0.75 * 0.25 / draws), under
+	// 0.007; the bound is over five of them, so the test fails by chance
+	// less than once in a million runs.
+	share := float64(older) / draws
+	if math.Abs(share-0.75) > 0.035 {
+		t.Errorf("age 60 picked %.1f%% of %d draws, want 75%% ± 3.5%%", 100*share, draws)
+	}
+}
+
+func TestWeightedRandomUnweighted(t *testing.T) {
+	ds := newTestDatastore(t)
+	addStudents(t, ds,
+		Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"},
+		Student{NIM: "1302", Name: "Budi", Age: 60, Address: "Padang"},
+	)
+
+	// Without a weight both are equally likely.
+	older := 0
+	const draws = 2000
+	for i := 0; i < draws; i++ {
+		picked, err := ds.FindRandom(1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if picked[0].Age == 60 {
+			older++
+		}
+	}
+	if share := float64(older) / draws; math.Abs(share-0.5) > 0.06 {
+		t.Errorf("age 60 picked %.1f%% of %d unweighted draws, want 50%%", 100*share, draws)
+	}
+}
+
+func TestWeightedRandomWithoutReplacement(t *testing.T) {
+	ds := newTestDatastore(t)
+	seedStudents(t, ds, 5)
+
+	picked, err := ds.FindRandom(10, "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, s := range picked {
+		if seen[s.NIM] {
+			t.Errorf("picked %s twice", s.NIM)
+		}
+		seen[s.NIM] = true
+	}
+	if len(picked) != 5 {
+		t.Errorf("picked %d of 5 students, want all", len(picked))
+	}
+}
+
+func TestWeightedRandomColumn(t *testing.T) {
+	h, ds := newTestRouter(t)
+	seedStudents(t, ds, 3)
+
+	for target, want := range map[string]int{
+		"/students/random?weight=age":                http.StatusOK,
+		"/students/random?weight=age&count=2":        http.StatusOK,
+		"/students/random?weight=name":               http.StatusBadRequest,
+		"/students/random?weight=age%3BDROP%20TABLE": http.StatusBadRequest,
+	} {
+		if rec := serve(h, http.MethodGet, target, ""); rec.Code != want {
+			t.Errorf("GET %s: status %d, want %d: %s", target, rec.Code, want, rec.Body)
+		}
+	}
+}
+
+func TestSQLWeightedRank(t *testing.T) {
+	for _, random := range []int64{math.MinInt64, -1, 0, 1, math.MaxInt64} {
+		rank := sqlWeightedRank(random, 20)
+		if math.IsInf(rank, 0) || math.IsNaN(rank) || rank < 0 {
+			t.Errorf("sqlWeightedRank(%d, 20) = %v, want a finite non-negative rank", random, rank)
+		}
+		if heavier := sqlWeightedRank(random, 60); heavier > rank {
+			t.Errorf("the same draw ranks weight 60 at %v, after weight 20 at %v", heavier, rank)
+		}
+	}
+}
+
+// TestForeignKeys checks that every connection of the pool enforces foreign
+// keys, which SQLite leaves off per connection, by holding several
+// connections open at once and violating a key on each.
+func TestForeignKeys(t *testing.T) {
+	const conns = 3
+	db, err := sql.Open(sqliteDriver, filepath.Join(t.TempDir(), "fk.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`CREATE TABLE guardians (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE wards (nim TEXT, guardian INTEGER REFERENCES guardians(id))`,
+		`INSERT INTO guardians VALUES (1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	ctx := context.Background()
+	for i := 0; i < conns; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(ctx, "INSERT INTO wards VALUES (?, 42)", fmt.Sprint(1301+i))
+		if !isConstraintError(err) {
+			t.Errorf("connection %d: orphan insert: %v, want a constraint error", i, err)
+		}
+		if _, err := conn.ExecContext(ctx, "INSERT INTO wards VALUES (?, 1)", fmt.Sprint(1301+i)); err != nil {
+			t.Errorf("connection %d: insert: %v", i, err)
+		}
+	}
+
+	if _, err := db.Exec("DELETE FROM guardians WHERE id = 1"); !isConstraintError(err) {
+		t.Errorf("deleting a referenced row: %v, want a constraint error", err)
+	}
+}
+
+func TestRegexpCache(t *testing.T) {
+	c := newRegexpCache(2)
+	for _, p := range []string{"a", "b", "a", "c"} {
+		if _, err := c.compile(p); err != nil {
+			t.Fatalf("compile %q: %v", p, err)
+		}
+	}
+	// "b" was the least recently used when "c" came in.
+	if _, ok := c.entries["b"]; ok || len(c.entries) != 2 || c.order.Len() != 2 {
+		t.Errorf("cached %d patterns including b: %v, want a and c only", len(c.entries), ok)
+	}
+
+	if _, err := c.compile(strings.Repeat("a", maxRegexpLength+1)); err == nil {
+		t.Error("compiled a pattern longer than maxRegexpLength")
+	}
+	if _, err := c.compile("("); err == nil {
+		t.Error("compiled an invalid pattern")
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("cached %d patterns after failures, want 2", len(c.entries))
+	}
+}
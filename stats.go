@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const defaultAgeBucket = 3
+
+// studentStats, addressCounts and ageDistribution serve dashboards that poll them, so their
+// results are cached for CACHE_TTL.
+
+func (h *handler) studentStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := cached(h.cache, schoolCacheKey(r, "stats"), h.store(r).Stats)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, stats)
+}
+
+func (h *handler) addressCounts(w http.ResponseWriter, r *http.Request) {
+	counts, err := cached(h.cache, schoolCacheKey(r, "addresses"), h.store(r).AddressCounts)
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, counts)
+}
+
+// ageDistribution counts students per age bucket of ?bucket= years over the
+// expected age range, for histograms.
+func (h *handler) ageDistribution(w http.ResponseWriter, r *http.Request) {
+	ages := h.cfg.ExpectedAge
+	span := int(ages.Max) - int(ages.Min) + 1
+
+	size := defaultAgeBucket
+	if v := r.URL.Query().Get("bucket"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > span {
+			respondError(w, r, http.StatusBadRequest, fmt.Sprintf("bucket must be between 1 and %d", span))
+			return
+		}
+		size = n
+	}
+
+	buckets, err := cached(h.cache, schoolCacheKey(r, "age-distribution:"+strconv.Itoa(size)), func() ([]ageBucket, error) {
+		return h.store(r).AgeDistribution(ages, uint16(size))
+	})
+	if err != nil {
+		respondDatastoreError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, buckets)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+)
+
+// schoolHeader names the tenant a request acts for.
+const schoolHeader = "X-School-Id"
+
+var validSchoolID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// scopeToSchool reads the school a request acts for from X-School-Id, which
+// the datastore then confines every query to. A malformed ID is rejected
+// with 400, and so is a missing one when required is set; otherwise a
+// request without the header acts for the empty school that single-tenant
+// deployments use.
+func scopeToSchool(required bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			school := r.Header.Get(schoolHeader)
+			if school == "" && required {
+				respondError(w, r, http.StatusBadRequest, schoolHeader+" header is required")
+				return
+			}
+			if school != "" && !validSchoolID.MatchString(school) {
+				respondError(w, r, http.StatusBadRequest, schoolHeader+" must be 1 to 64 letters, digits, '-' or '_'")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), schoolCtxKey, school)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func schoolFromContext(ctx context.Context) string {
+	school, _ := ctx.Value(schoolCtxKey).(string)
+	return school
+}
+
+// schoolCacheKey scopes a cache key to the school of the request, so one
+// school never sees the aggregates of another.
+func schoolCacheKey(r *http.Request, key string) string {
+	return schoolFromContext(r.Context()) + "/" + key
+}
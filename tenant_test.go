@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchoolHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		header   []string
+		want     int
+	}{
+		{"missing", false, nil, http.StatusOK},
+		{"present", false, []string{schoolHeader, "school-a"}, http.StatusOK},
+		{"malformed", false, []string{schoolHeader, "a b"}, http.StatusBadRequest},
+		{"too long", false, []string{schoolHeader, string(make([]byte, 65))}, http.StatusBadRequest},
+		{"missing when required", true, nil, http.StatusBadRequest},
+		{"present when required", true, []string{schoolHeader, "school-a"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RequireSchoolID = tt.required
+			h, _ := newTestRouter(t, WithConfig(cfg))
+
+			rec := serve(h, http.MethodGet, "/students", "", tt.header...)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestSchoolHeaderRequiredByDefault(t *testing.T) {
+	h := newRouter(newTestDatastore(t), WithConfig(defaultConfig()), WithoutLogger(), WithoutRecoverer())
+
+	if rec := serve(h, http.MethodGet, "/students", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("without %s: status = %d, want 400: %s", schoolHeader, rec.Code, rec.Body)
+	}
+	if rec := serve(h, http.MethodGet, "/students", "", schoolHeader, "school-a"); rec.Code != http.StatusOK {
+		t.Errorf("with %s: status = %d, want 200: %s", schoolHeader, rec.Code, rec.Body)
+	}
+}
+
+// TestSchoolIsolation checks that a student written for one school is
+// invisible to, and cannot be changed by, requests acting for another.
+func TestSchoolIsolation(t *testing.T) {
+	h, _ := newTestRouter(t)
+
+	if rec := serve(h, http.MethodPost, "/students", studentJSON("1301"), schoolHeader, "school-a"); rec.Code != http.StatusCreated {
+		t.Fatalf("create for school-a: status %d: %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		name   string
+		school string
+		method string
+		target string
+		body   string
+	}{
+		{"get", "school-b", http.MethodGet, "/students/1301", ""},
+		{"get without a school", "", http.MethodGet, "/students/1301", ""},
+		{"list", "school-b", http.MethodGet, "/students", ""},
+		{"export", "school-b", http.MethodGet, "/students.csv", ""},
+		{"update", "school-b", http.MethodPut, "/students", `{"nim":"1301","name":"Mallory","age":30,"address":"Jakarta"}`},
+		{"batch update", "school-b", http.MethodPut, "/students/batch?mode=besteffort", `[{"nim":"1301","name":"Mallory","age":30,"address":"Jakarta"}]`},
+		{"reset address", "school-b", http.MethodDelete, "/students/1301/address", ""},
+		{"delete", "school-b", http.MethodDelete, "/students/1301", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.body, schoolHeader, tt.school)
+
+			switch tt.name {
+			case "get", "get without a school":
+				if rec.Code != http.StatusNotFound {
+					t.Errorf("status = %d, want 404: %s", rec.Code, rec.Body)
+				}
+			case "list":
+				if nims := listNIMs(t, rec); len(nims) != 0 {
+					t.Errorf("school-b lists %v of school-a", nims)
+				}
+			case "export":
+				if nims := exportNIMs(t, rec.Body.String()); len(nims) != 0 {
+					t.Errorf("school-b exports %v of school-a", nims)
+				}
+			}
+
+			// Whatever school-b did, school-a's student is unchanged.
+			rec = serve(h, http.MethodGet, "/students/1301", "", schoolHeader, "school-a")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("get for school-a: status %d: %s", rec.Code, rec.Body)
+			}
+			var got Student
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode student: %v", err)
+			}
+			if got.Name != "Ana" || got.Age != 20 || got.Address != "Bandung" {
+				t.Errorf("school-a's student = %+v, want it unchanged", got)
+			}
+		})
+	}
+}
+
+func TestNIMScopeCollisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope string
+		// wantOther is the status of creating a NIM another school has.
+		wantOther int
+	}{
+		{"global", nimScopeGlobal, http.StatusConflict},
+		{"per school", nimScopeSchool, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, err := newDatastore(":memory:", tt.scope)
+			if err != nil {
+				t.Fatalf("open datastore: %v", err)
+			}
+			t.Cleanup(func() { ds.StudentSQLite.Close() })
+			h := newRouter(ds, WithoutLogger(), WithoutRecoverer())
+
+			if rec := serve(h, http.MethodPost, "/students", studentJSON("1301"), schoolHeader, "school-a"); rec.Code != http.StatusCreated {
+				t.Fatalf("create in school-a: status %d: %s", rec.Code, rec.Body)
+			}
+			if rec := serve(h, http.MethodPost, "/students", studentJSON("1301"), schoolHeader, "school-a"); rec.Code != http.StatusConflict {
+				t.Errorf("create again in school-a: status %d, want %d", rec.Code, http.StatusConflict)
+			}
+			if rec := serve(h, http.MethodPost, "/students", studentJSON("1301"), schoolHeader, "school-b"); rec.Code != tt.wantOther {
+				t.Errorf("create in school-b: status %d, want %d: %s", rec.Code, tt.wantOther, rec.Body)
+			}
+			if rec := serve(h, http.MethodPost, "/students", studentJSON("1301"), schoolHeader, "school-b"); rec.Code != http.StatusConflict {
+				t.Errorf("create again in school-b: status %d, want %d", rec.Code, http.StatusConflict)
+			}
+		})
+	}
+}
+
+func TestNIMScopeRekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "students.db")
+	open := func(scope string) (*Datastore, error) {
+		ds, err := newDatastore(path, scope)
+		if err == nil {
+			t.Cleanup(func() { ds.StudentSQLite.Close() })
+		}
+		return ds, err
+	}
+
+	ds, err := open(nimScopeGlobal)
+	if err != nil {
+		t.Fatalf("open global: %v", err)
+	}
+	addStudents(t, ds.ForSchool("school-a"), Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"})
+	addStudents(t, ds.ForSchool("school-b"), Student{NIM: "1302", Name: "Budi", Age: 21, Address: "Padang"})
+	ds.StudentSQLite.Close()
+
+	ds, err = open(nimScopeSchool)
+	if err != nil {
+		t.Fatalf("rekey to per school: %v", err)
+	}
+	addStudents(t, ds.ForSchool("school-b"), Student{NIM: "1301", Name: "Citra", Age: 22, Address: "Medan"})
+	if n := countStudents(t, ds); n != 3 {
+		t.Fatalf("%d students after rekeying, want 3", n)
+	}
+	ds.StudentSQLite.Close()
+
+	// Two schools now share 1301, so NIMs cannot become global again.
+	if _, err := open(nimScopeGlobal); err == nil {
+		t.Fatal("rekeyed to global while two schools share a NIM")
+	}
+
+	ds, err = open(nimScopeSchool)
+	if err != nil {
+		t.Fatalf("reopen per school: %v", err)
+	}
+	if n := countStudents(t, ds); n != 3 {
+		t.Errorf("%d students after the failed rekey, want 3", n)
+	}
+	for school, want := range map[string]string{"school-a": "Ana", "school-b": "Citra"} {
+		if got, err := ds.ForSchool(school).FindByNIM("1301"); err != nil || got.Name != want {
+			t.Errorf("%s has %+v, %v, want %s", school, got, err, want)
+		}
+	}
+
+	if _, err := open("district"); err == nil {
+		t.Error("opened with an unknown NIM scope")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"sort"
+)
+
+// tlsVersions are the TLS_MIN_VERSION values accepted. TLS 1.0 and 1.1 are
+// left out on purpose: they fail compliance audits.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCipherSuites are the TLS 1.2 suites offered: forward secret key
+// exchange with authenticated encryption only. TLS 1.3 suites are not
+// configurable in Go and are all secure.
+var tlsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// tlsConfig returns the TLS settings of the server, refusing handshakes
+// below minVersion, one of the keys of tlsVersions.
+func tlsConfig(minVersion string) *tls.Config {
+	return &tls.Config{
+		MinVersion:   tlsVersions[minVersion],
+		CipherSuites: tlsCipherSuites,
+	}
+}
+
+func tlsVersionNames() []string {
+	names := make([]string, 0, len(tlsVersions))
+	for name := range tlsVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSMinVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		minVersion    string
+		clientVersion uint16
+		clientSuites  []uint16
+		wantRefused   bool
+	}{
+		{"TLS 1.0 refused", "1.2", tls.VersionTLS10, nil, true},
+		{"TLS 1.1 refused", "1.2", tls.VersionTLS11, nil, true},
+		{"TLS 1.2 accepted", "1.2", tls.VersionTLS12, nil, false},
+		{"TLS 1.3 accepted", "1.2", tls.VersionTLS13, nil, false},
+		{"CBC suite refused", "1.2", tls.VersionTLS12, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}, true},
+		{"TLS 1.2 refused above the minimum", "1.3", tls.VersionTLS12, nil, true},
+		{"TLS 1.3 at the minimum", "1.3", tls.VersionTLS13, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv.TLS = tlsConfig(tt.minVersion)
+			// The refused handshakes would be logged.
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			srv.StartTLS()
+			defer srv.Close()
+
+			client := srv.Client()
+			transport := client.Transport.(*http.Transport)
+			transport.TLSClientConfig.MinVersion = tt.clientVersion
+			transport.TLSClientConfig.MaxVersion = tt.clientVersion
+			transport.TLSClientConfig.CipherSuites = tt.clientSuites
+
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if refused := err != nil; refused != tt.wantRefused {
+				t.Errorf("refused = %v (%v), want %v", refused, err, tt.wantRefused)
+			}
+		})
+	}
+}
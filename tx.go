@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type ctxKey int
+
+const (
+	datastoreCtxKey ctxKey = iota
+	schoolCtxKey
+)
+
+// txMiddleware runs each request inside a database transaction. The
+// response is held back until the transaction is settled: it is committed
+// when the handler responds with a 2xx status and rolled back on any other
+// status or on panic. A failed commit replaces the handler's response with a
+// 503 when the database was busy and a 500 otherwise, so clients are never
+// told a write succeeded that did not persist. Mount it on a route group to
+// opt in; routes outside the group keep using the plain connection pool.
+//
+// Because the response is buffered, handlers in the group cannot stream:
+// the writer they get is not an http.Flusher. Streaming routes belong
+// outside the group.
+func txMiddleware(ds *Datastore) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tx, err := ds.StudentSQLite.BeginTx(r.Context(), nil)
+			if err != nil {
+				respondError(w, r, http.StatusInternalServerError, errInternalServer.Error())
+				return
+			}
+
+			defer func() {
+				if rvr := recover(); rvr != nil {
+					tx.Rollback()
+					panic(rvr)
+				}
+			}()
+
+			buf := &bufferedResponse{header: w.Header().Clone()}
+			ctx := context.WithValue(r.Context(), datastoreCtxKey, ds.WithTx(tx))
+			next.ServeHTTP(buf, r.WithContext(ctx))
+
+			status := buf.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status >= 200 && status < 300 {
+				if err := tx.Commit(); err != nil && err != sql.ErrTxDone {
+					log.Printf("commit transaction: %v", err)
+					if isBusy(err) {
+						respondError(w, r, http.StatusServiceUnavailable, "database is busy, try again later")
+					} else {
+						respondError(w, r, http.StatusInternalServerError, errInternalServer.Error())
+					}
+					return
+				}
+			} else if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+				log.Printf("rollback transaction: %v", err)
+			}
+
+			buf.flushTo(w, status)
+		})
+	}
+}
+
+// bufferedResponse collects a response, headers included, so txMiddleware
+// can still discard it once the handler has returned.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// flushTo sends the collected response to w with status.
+func (b *bufferedResponse) flushTo(w http.ResponseWriter, status int) {
+	dst := w.Header()
+	for k := range dst {
+		if _, ok := b.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range b.header {
+		dst[k] = v
+	}
+	w.WriteHeader(status)
+	w.Write(b.body.Bytes())
+}
+
+// isBusy reports whether err is SQLite giving up on a lock another
+// connection held for longer than the busy timeout.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// datastoreFromContext returns the transaction-scoped datastore stored by
+// txMiddleware, or fallback when the request is not running in a transaction.
+func datastoreFromContext(ctx context.Context, fallback *Datastore) *Datastore {
+	if ds, ok := ctx.Value(datastoreCtxKey).(*Datastore); ok {
+		return ds
+	}
+	return fallback
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTxMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		panics     bool
+		wantStored int
+	}{
+		{"committed on 2xx", http.StatusCreated, false, 1},
+		{"rolled back on 4xx", http.StatusConflict, false, 0},
+		{"rolled back on 5xx", http.StatusInternalServerError, false, 0},
+		{"rolled back on panic", 0, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := newTestDatastore(t)
+			var flusher bool
+			h := txMiddleware(ds)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, flusher = w.(http.Flusher)
+				store := datastoreFromContext(r.Context(), ds)
+				if err := store.Save(Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"}); err != nil {
+					t.Errorf("save: %v", err)
+				}
+				if tt.panics {
+					panic("boom")
+				}
+				w.WriteHeader(tt.status)
+			}))
+
+			rec := httptest.NewRecorder()
+			func() {
+				defer func() {
+					if rvr := recover(); (rvr != nil) != tt.panics {
+						t.Errorf("recovered %v, want a panic: %v", rvr, tt.panics)
+					}
+				}()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/students", nil))
+			}()
+
+			if !tt.panics && rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			// The response is buffered until the transaction is settled,
+			// so handlers in the group must not be able to stream.
+			if flusher {
+				t.Error("handler got an http.Flusher")
+			}
+			if n := countStudents(t, ds); n != tt.wantStored {
+				t.Errorf("%d students stored, want %d", n, tt.wantStored)
+			}
+		})
+	}
+}
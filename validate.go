@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	minStudentAge    = 15
+	maxStudentAge    = 100
+	maxNIMLength     = 20
+	maxNameLength    = 100
+	maxAddressLength = 255
+)
+
+// ValidationErrors maps a JSON field name to what is wrong with it.
+type ValidationErrors map[string]string
+
+func (v ValidationErrors) Error() string {
+	fields := make([]string, 0, len(v))
+	for field := range v {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		msgs = append(msgs, field+": "+v[field])
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the student against the business rules and returns
+// ValidationErrors describing every failing field, or nil.
+func (s Student) Validate() error {
+	errs := ValidationErrors{}
+
+	switch {
+	case strings.TrimSpace(s.NIM) == "":
+		errs["nim"] = "is required"
+	case utf8.RuneCountInString(s.NIM) > maxNIMLength:
+		errs["nim"] = fmt.Sprintf("must be at most %d characters", maxNIMLength)
+	}
+
+	switch {
+	case strings.TrimSpace(s.Name) == "":
+		errs["name"] = "is required"
+	case utf8.RuneCountInString(s.Name) > maxNameLength:
+		errs["name"] = fmt.Sprintf("must be at most %d characters", maxNameLength)
+	}
+
+	if s.Age < minStudentAge || s.Age > maxStudentAge {
+		errs["age"] = fmt.Sprintf("must be between %d and %d", minStudentAge, maxStudentAge)
+	}
+
+	switch {
+	case strings.TrimSpace(s.Address) == "":
+		errs["address"] = "is required"
+	case utf8.RuneCountInString(s.Address) > maxAddressLength:
+		errs["address"] = fmt.Sprintf("must be at most %d characters", maxAddressLength)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
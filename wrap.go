@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// studentResource names student resources, as the JSON:API type and as the
+// key ?wrap=true puts lists of students under.
+const studentResource = "students"
+
+// wrapLists reports whether the client asked with ?wrap=true for lists to
+// be sent as an object with the list under the name of its resource, e.g.
+// {"students": [...]}, as some older clients expect.
+func wrapLists(r *http.Request) bool {
+	wrap, _ := strconv.ParseBool(r.URL.Query().Get("wrap"))
+	return wrap
+}
+
+// wrapList puts a list of students under studentResource. A paged list
+// keeps its meta next to it. Other values are returned as they are.
+func wrapList(v any) any {
+	switch v := v.(type) {
+	case []studentView:
+		return map[string]any{studentResource: v}
+	case listResponse:
+		return map[string]any{studentResource: v.Data, "meta": v.Meta}
+	default:
+		return v
+	}
+}
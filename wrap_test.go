@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// topLevelKeys returns the sorted members of a JSON object response, or nil
+// when it is not an object.
+func topLevelKeys(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil
+	}
+	keys := []string{}
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestWrapLists(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header []string
+		want   []string
+	}{
+		{"paged list", "/students?limit=10&wrap=true", nil, []string{"meta", "students"}},
+		{"bare list", "/students?wrap=true", nil, []string{"students"}},
+		{"random list", "/students/random?count=2&wrap=true", nil, []string{"students"}},
+		{"with other options", "/students?limit=10&wrap=true&naming=camel", nil, []string{"meta", "students"}},
+		{"single student", "/students/1301?wrap=true", nil, []string{"address", "age", "created_at", "name", "nim", "updated_at"}},
+		{"not asked for", "/students?limit=10", nil, []string{"data", "meta"}},
+		{"turned off", "/students?limit=10&wrap=false", nil, []string{"data", "meta"}},
+		{"bare list not asked for", "/students", nil, nil},
+		{"JSON:API", "/students?limit=10&wrap=true", []string{"Accept", jsonAPIMediaType}, []string{"data", "links", "meta"}},
+	}
+
+	h, ds := newTestRouter(t)
+	addStudents(t, ds,
+		Student{NIM: "1301", Name: "Ana", Age: 20, Address: "Bandung"},
+		Student{NIM: "1302", Name: "Budi", Age: 21, Address: "Padang"},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.target, "", tt.header...)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if got := topLevelKeys(t, rec.Body.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("members %v, want %v: %s", got, tt.want, rec.Body)
+			}
+		})
+	}
+
+	var wrapped struct {
+		Students []Student `json:"students"`
+	}
+	rec := serve(h, http.MethodGet, "/students?wrap=true", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &wrapped); err != nil || len(wrapped.Students) != 2 {
+		t.Errorf("wrapped %s, want both students under students", rec.Body)
+	}
+}